@@ -176,3 +176,108 @@ func TestJsonUnmarshal(t *testing.T) {
 	assert.Equal(t, "John", v.Name)
 	assert.Equal(t, 30, v.Age)
 }
+
+func TestTomlCodec(t *testing.T) {
+	const s = "name = \"John\"\n\n[server]\nport = 8080\n"
+	var v map[string]any
+	err := GetCodec(TomlName).Unmarshal([]byte(s), &v)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]any{"name": "John", "server": map[string]any{"port": int64(8080)}}, v)
+
+	bs, err := GetCodec(TomlName).Marshal(v)
+	assert.Nil(t, err)
+	var got map[string]any
+	assert.Nil(t, GetCodec(TomlName).Unmarshal(bs, &got))
+	assert.Equal(t, v, got)
+}
+
+func TestPropertiesCodec(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want map[string]any
+	}{
+		{
+			name: "separators",
+			data: "a=1\nb: 2\nc 3\n  d  =  4\n# comment\n! comment\n",
+			want: map[string]any{"a": "1", "b": "2", "c": "3", "d": "4"},
+		},
+		{
+			name: "nested",
+			data: "app.name=mcdull\napp.hosts[0]=a\napp.hosts[1]=b\napp.users[0].name=kk\n",
+			want: map[string]any{"app": map[string]any{
+				"name":  "mcdull",
+				"hosts": []any{"a", "b"},
+				"users": []any{map[string]any{"name": "kk"}},
+			}},
+		},
+		{
+			name: "escapes",
+			data: "key\\ with\\=sep = tab\\there\\u4e2d\nmulti = a, \\\n    b\r\nwin = c\r\n",
+			want: map[string]any{"key with=sep": "tab\there中", "multi": "a, b", "win": "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v map[string]any
+			assert.Nil(t, GetCodec(PropertiesName).Unmarshal([]byte(tt.data), &v))
+			assert.Equal(t, tt.want, v)
+
+			bs, err := GetCodec(PropertiesName).Marshal(v)
+			assert.Nil(t, err)
+			var got map[string]any
+			assert.Nil(t, GetCodec(PropertiesName).Unmarshal(bs, &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	// the first one of the conflicting keys is kept
+	var v map[string]any
+	assert.Nil(t, GetCodec(PropertiesName).Unmarshal([]byte("logging.level=INFO\nlogging.level.root=DEBUG"), &v))
+	assert.Equal(t, map[string]any{"logging": map[string]any{"level": "INFO"}}, v)
+	v = nil
+	assert.Nil(t, GetCodec(PropertiesName).Unmarshal([]byte("a.b=2\na=1"), &v))
+	assert.Equal(t, map[string]any{"a": map[string]any{"b": "2"}}, v)
+
+	bs, err := GetCodec(PropertiesName).Marshal(map[string]any{"port": 8080, "name": " kk"})
+	assert.Nil(t, err)
+	assert.Equal(t, "name=\\ kk\nport=8080\n", string(bs))
+}
+
+func TestIniCodec(t *testing.T) {
+	const s = `; comment
+name = mcdull
+[server]
+host = "0.0.0.0"
+port: 8080
+[server.tls]
+enabled = true
+`
+	var v map[string]any
+	assert.Nil(t, GetCodec(IniName).Unmarshal([]byte(s), &v))
+	want := map[string]any{
+		"name": "mcdull",
+		"server": map[string]any{
+			"host": "0.0.0.0",
+			"port": "8080",
+			"tls":  map[string]any{"enabled": "true"},
+		},
+	}
+	assert.Equal(t, want, v)
+
+	bs, err := GetCodec(IniName).Marshal(v)
+	assert.Nil(t, err)
+	assert.Equal(t, "name = mcdull\n\n[server]\nhost = 0.0.0.0\nport = 8080\ntls.enabled = true\n", string(bs))
+	var got map[string]any
+	assert.Nil(t, GetCodec(IniName).Unmarshal(bs, &got))
+	assert.Equal(t, want, got)
+
+	var cfg struct {
+		Server struct {
+			Host string `json:"host"`
+		} `json:"server"`
+	}
+	assert.Nil(t, GetCodec(IniName).Unmarshal([]byte(s), &cfg))
+	assert.Equal(t, "0.0.0.0", cfg.Server.Host)
+	assert.NotNil(t, GetCodec(IniName).Unmarshal([]byte("[server"), &v))
+}
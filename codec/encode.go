@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/go-playground/form/v4"
+	"github.com/pelletier/go-toml/v2"
 	"github.com/vmihailenco/msgpack/v5"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
@@ -22,6 +23,7 @@ const (
 	YamlName    = "yaml"
 	MsgpackName = "msgpack"
 	FormName    = "x-www-form-urlencoded"
+	TomlName    = "toml"
 )
 
 func init() {
@@ -32,6 +34,9 @@ func init() {
 	registerCodec(protoCodec{})
 	registerCodec(yamlCodec{})
 	registerCodec(msgpackCodec{})
+	registerCodec(tomlCodec{})
+	registerCodec(propertiesCodec{})
+	registerCodec(iniCodec{})
 	registerCodec(formCodec{encoder: formEncoder, decoder: formDecoder})
 }
 
@@ -93,6 +98,7 @@ type (
 	protoCodec   codec
 	yamlCodec    codec
 	msgpackCodec codec
+	tomlCodec    codec
 	formCodec    struct {
 		encoder *form.Encoder
 		decoder *form.Decoder
@@ -206,6 +212,19 @@ func (msgpackCodec) Name() string {
 	return MsgpackName
 }
 
+// tomlCodec
+func (tomlCodec) Marshal(v interface{}) ([]byte, error) {
+	return toml.Marshal(v)
+}
+
+func (tomlCodec) Unmarshal(data []byte, v interface{}) error {
+	return toml.Unmarshal(data, v)
+}
+
+func (tomlCodec) Name() string {
+	return TomlName
+}
+
 //formCodec
 func (c formCodec) Marshal(v interface{}) ([]byte, error) {
 	var vs url.Values
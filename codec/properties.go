@@ -0,0 +1,430 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mcdull-kk/pkg/log"
+)
+
+const (
+	PropertiesName = "properties"
+	IniName        = "ini"
+)
+
+type (
+	propertiesCodec codec
+	iniCodec        codec
+)
+
+// propertiesCodec reads and writes Java properties, the dotted keys are
+// expanded into nested maps, and key[i] into slices. All values are strings.
+func (propertiesCodec) Marshal(v interface{}) ([]byte, error) {
+	m, err := toMap(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	writeProperties(&buf, flatten("", m))
+	return buf.Bytes(), nil
+}
+
+func (propertiesCodec) Unmarshal(data []byte, v interface{}) error {
+	m := make(map[string]any)
+	err := readProperties(data, func(key, value string) error {
+		expand(m, key, value)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return assign(m, v)
+}
+
+func (propertiesCodec) Name() string {
+	return PropertiesName
+}
+
+// iniCodec reads and writes INI, the keys of a section are nested in the
+// section, and the dotted sections and keys are expanded like properties.
+func (iniCodec) Marshal(v interface{}) ([]byte, error) {
+	m, err := toMap(v)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		buf      bytes.Buffer
+		sections []string
+		global   = make(map[string]string)
+	)
+	for k, val := range m {
+		if _, ok := val.(map[string]any); ok {
+			sections = append(sections, k)
+			continue
+		}
+		flattenInto(k, val, global)
+	}
+	writeIni(&buf, global)
+	sort.Strings(sections)
+	for _, section := range sections {
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		fmt.Fprintf(&buf, "[%s]\n", section)
+		writeIni(&buf, flatten("", m[section]))
+	}
+	return buf.Bytes(), nil
+}
+
+func (iniCodec) Unmarshal(data []byte, v interface{}) error {
+	var (
+		m       = make(map[string]any)
+		section string
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+	)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return fmt.Errorf("ini: invalid section at line %d: %s", n, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.IndexAny(line, "=:")
+		if i < 0 {
+			return fmt.Errorf("ini: invalid key at line %d: %s", n, line)
+		}
+		key, value := strings.TrimSpace(line[:i]), unquote(strings.TrimSpace(line[i+1:]))
+		if section != "" {
+			key = section + "." + key
+		}
+		expand(m, key, value)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return assign(m, v)
+}
+
+func (iniCodec) Name() string {
+	return IniName
+}
+
+// readProperties calls fn with the unescaped key and value of each
+// property, continuation lines are joined.
+func readProperties(data []byte, fn func(key, value string) error) error {
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+		for continued(line) && i+1 < len(lines) {
+			i++
+			line = line[:len(line)-1] + strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+		}
+		if continued(line) {
+			line = line[:len(line)-1]
+		}
+		key, value := splitProperty(line)
+		if err := fn(unescape(key), unescape(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// continued reports whether line ends with an odd number of backslashes.
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitProperty splits line at the first unescaped '=', ':' or whitespace.
+func splitProperty(line string) (key, value string) {
+	i := 0
+	for ; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			break
+		}
+	}
+	if i > len(line) {
+		i = len(line)
+	}
+	value = strings.TrimLeft(line[i:], " \t\f")
+	if value != "" && (value[0] == '=' || value[0] == ':') {
+		value = strings.TrimLeft(value[1:], " \t\f")
+	}
+	return line[:i], value
+}
+
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 <= len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					b.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func escape(s string, key bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case ' ':
+			if key || i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(' ')
+		case '=', ':', '#', '!':
+			if key {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func writeProperties(buf *bytes.Buffer, kvs map[string]string) {
+	for _, k := range sortedKeys(kvs) {
+		buf.WriteString(escape(k, true))
+		buf.WriteByte('=')
+		buf.WriteString(escape(kvs[k], false))
+		buf.WriteByte('\n')
+	}
+}
+
+func writeIni(buf *bytes.Buffer, kvs map[string]string) {
+	for _, k := range sortedKeys(kvs) {
+		v := kvs[k]
+		if v != strings.TrimSpace(v) || strings.ContainsAny(v, "\"'\r\n") {
+			v = strconv.Quote(v)
+		}
+		fmt.Fprintf(buf, "%s = %s\n", k, v)
+	}
+}
+
+func unquote(s string) string {
+	if len(s) < 2 {
+		return s
+	}
+	switch {
+	case s[0] == '"' && s[len(s)-1] == '"':
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+	case s[0] == '\'' && s[len(s)-1] == '\'':
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// expand sets value into m by the dotted key,
+// such as: app.hosts[0] = "a" => map[app][hosts] = []any{"a"}.
+// If a key is both a value and the parent of other keys,
+// such as a=1 and a.b=2, the first one is kept.
+func expand(m map[string]any, key string, value any) {
+	parts := splitKey(key)
+	cur := m
+	for i, p := range parts {
+		if i == len(parts)-1 {
+			if _, ok := cur[p].(map[string]any); ok {
+				log.Warnf("duplicate key: %s", key)
+				return
+			}
+			cur[p] = value
+			return
+		}
+		switch next := cur[p].(type) {
+		case nil:
+			sub := make(map[string]any)
+			cur[p] = sub
+			cur = sub
+		case map[string]any:
+			cur = next
+		default:
+			log.Warnf("duplicate key: %s", strings.Join(parts[:i+1], "."))
+			return
+		}
+	}
+}
+
+// splitKey splits key by dots, and the indexes into parts like "[0]".
+func splitKey(key string) []string {
+	var parts []string
+	for _, seg := range strings.Split(key, ".") {
+		i := strings.IndexByte(seg, '[')
+		if i < 0 || !strings.HasSuffix(seg, "]") {
+			parts = append(parts, seg)
+			continue
+		}
+		if i > 0 {
+			parts = append(parts, seg[:i])
+		}
+		for _, idx := range strings.SplitAfter(seg[i:], "]") {
+			if idx != "" {
+				parts = append(parts, idx)
+			}
+		}
+	}
+	return parts
+}
+
+// index returns the index of the part like "[0]".
+func index(part string) (int, bool) {
+	if len(part) < 3 || part[0] != '[' || part[len(part)-1] != ']' {
+		return 0, false
+	}
+	i, err := strconv.Atoi(part[1 : len(part)-1])
+	return i, err == nil && i >= 0
+}
+
+// normalize converts the maps keyed by all the indexes from 0 into slices.
+func normalize(v any) any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	for k, sub := range m {
+		m[k] = normalize(sub)
+	}
+	s := make([]any, len(m))
+	for k, sub := range m {
+		i, ok := index(k)
+		if !ok || i >= len(m) {
+			return m
+		}
+		s[i] = sub
+	}
+	if len(s) == 0 {
+		return m
+	}
+	return s
+}
+
+// flatten returns the dotted keys and values of v.
+func flatten(prefix string, v any) map[string]string {
+	kvs := make(map[string]string)
+	flattenInto(prefix, v, kvs)
+	return kvs
+}
+
+func flattenInto(prefix string, v any, kvs map[string]string) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, sub := range val {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flattenInto(k, sub, kvs)
+		}
+	case []any:
+		for i, sub := range val {
+			flattenInto(prefix+"["+strconv.Itoa(i)+"]", sub, kvs)
+		}
+	default:
+		kvs[prefix] = Repr(val)
+	}
+}
+
+func sortedKeys(kvs map[string]string) []string {
+	keys := make([]string, 0, len(kvs))
+	for k := range kvs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// toMap converts v into a generic map by its JSON form.
+func toMap(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var m map[string]any
+	if err = decoder.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// assign sets the decoded m into v, a map target is filled in place.
+func assign(m map[string]any, v any) error {
+	for k, val := range m {
+		m[k] = normalize(val)
+	}
+	if p, ok := v.(*map[string]any); ok {
+		if *p == nil {
+			*p = m
+			return nil
+		}
+		for k, val := range m {
+			(*p)[k] = val
+		}
+		return nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -1,7 +1,9 @@
 package apollo
 
 import (
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/apolloconfig/agollo/v4"
 	"github.com/apolloconfig/agollo/v4/constant"
@@ -13,6 +15,8 @@ import (
 	"github.com/mcdull-kk/pkg/log"
 )
 
+var setLogger sync.Once
+
 type (
 	apollo struct {
 		client agollo.Client
@@ -39,7 +43,10 @@ func NewSource(opts ...Option) config.Source {
 		panic("appid or ip or namespaceName exist empty")
 	}
 
-	agollo.SetLogger(log.GetGlobalLogger())
+	// the logger of agollo is global, which is read by running clients
+	setLogger.Do(func() {
+		agollo.SetLogger(log.GetGlobalLogger())
+	})
 
 	client, err := agollo.StartWithConfig(func() (*apolloconfig.AppConfig, error) {
 		return opt.AppConfig, nil
@@ -63,32 +70,14 @@ func (e *apollo) Load() (kv []*config.KeyValue, err error) {
 	namespaces := strings.Split(e.opt.NamespaceName, ",")
 
 	for _, ns := range namespaces {
-		if !e.opt.originConfig {
-			kv, err := e.getConfig(ns)
-			if err != nil {
-				log.Errorf("apollo get config failed，err:%v", err)
-				continue
-			}
-			kvs = append(kvs, kv)
-			continue
-		}
-
-		fm := configFileformat(ns)
-		if fm == constant.JSON || fm == constant.YML || fm == constant.YAML || fm == constant.XML {
-			kv, err := e.getOriginConfig(ns)
-			if err != nil {
-				log.Errorf("apollo get config failed，err:%v", err)
-				continue
-			}
-			kvs = append(kvs, kv)
-			continue
-		}
-		kv, err := e.getConfig(ns)
+		kv, err := e.namespaceKeyValue(ns, e.values(ns))
 		if err != nil {
 			log.Errorf("apollo get config failed，err:%v", err)
 			continue
 		}
-		kvs = append(kvs, kv)
+		if !kv.Deleted {
+			kvs = append(kvs, kv)
+		}
 	}
 	return kvs, nil
 }
@@ -102,36 +91,83 @@ func (e *apollo) Close() (err error) {
 	return
 }
 
-func (e *apollo) getConfig(ns string) (*config.KeyValue, error) {
-	next := map[string]interface{}{}
-	e.client.GetConfigCache(ns).Range(func(key, value interface{}) bool {
-		// all values are out properties format
-		resolve(genKey(ns, key.(string)), value, next)
+// values returns the cached values of namespace.
+func (e *apollo) values(ns string) map[string]any {
+	values := map[string]any{}
+	cache := e.client.GetConfigCache(ns)
+	if cache == nil {
+		return values
+	}
+	cache.Range(func(key, value interface{}) bool {
+		values[key.(string)] = value
 		return true
 	})
-	f := format(ns)
-	code := codec.GetCodec(f)
-	val, err := code.Marshal(next)
+	return values
+}
+
+// namespaceKeyValue rebuilds the KeyValue of namespace from all of its values,
+// the namespace without any values is reported deleted.
+func (e *apollo) namespaceKeyValue(ns string, values map[string]any) (*config.KeyValue, error) {
+	fm := configFileformat(ns)
+	if e.opt.originConfig && (fm == constant.JSON || fm == constant.YML || fm == constant.YAML || fm == constant.XML) {
+		content, ok := values["content"].(string)
+		if !ok {
+			return &config.KeyValue{Key: ns, Deleted: true}, nil
+		}
+		// serialize the namespace content KeyValue into bytes.
+		return &config.KeyValue{
+			Key:    ns,
+			Value:  []byte(content),
+			Format: format(ns),
+		}, nil
+	}
+	if len(values) == 0 {
+		return &config.KeyValue{Key: ns, Deleted: true}, nil
+	}
+	if format(ns) == codec.PropertiesName {
+		return propertiesKeyValue(ns, values)
+	}
+	return jsonKeyValue(ns, values)
+}
+
+// jsonKeyValue encodes the parsed values of a json, yaml or xml namespace
+// in json to keep their types, the keys are prefixed by the namespace name.
+func jsonKeyValue(ns string, values map[string]any) (*config.KeyValue, error) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	next := make(map[string]any)
+	for _, k := range keys {
+		resolve(genKey(ns, k), values[k], next)
+	}
+	val, err := codec.GetCodec(codec.JsonName).Marshal(next)
 	if err != nil {
 		return nil, err
 	}
 	return &config.KeyValue{
 		Key:    ns,
 		Value:  val,
-		Format: f,
+		Format: codec.JsonName,
 	}, nil
 }
 
-func (e apollo) getOriginConfig(ns string) (*config.KeyValue, error) {
-	value, err := e.client.GetConfigCache(ns).Get("content")
+// propertiesKeyValue encodes the values of a properties namespace,
+// the keys are prefixed by the namespace name.
+func propertiesKeyValue(ns string, values map[string]any) (*config.KeyValue, error) {
+	next := make(map[string]any, len(values))
+	for k, v := range values {
+		next[genKey(ns, k)] = v
+	}
+	val, err := codec.GetCodec(codec.PropertiesName).Marshal(next)
 	if err != nil {
 		return nil, err
 	}
-	// serialize the namespace content KeyValue into bytes.
 	return &config.KeyValue{
 		Key:    ns,
-		Value:  []byte(value.(string)),
-		Format: format(ns),
+		Value:  val,
+		Format: codec.PropertiesName,
 	}, nil
 }
 
@@ -146,13 +182,13 @@ func configFileformat(ns string) constant.ConfigFileFormat {
 func format(ns string) string {
 	arr := strings.Split(ns, ".")
 	suffix := arr[len(arr)-1]
-	if len(arr) <= 1 || suffix == "properties" {
-		return "json"
+	if len(arr) <= 1 {
+		return codec.PropertiesName
 	}
 	fm := constant.ConfigFileFormat("." + suffix)
 	if fm != constant.JSON && fm != constant.YAML && fm != constant.XML && fm != constant.YML {
 		// fallback
-		return "json"
+		return codec.PropertiesName
 	}
 	return suffix
 }
@@ -1,41 +1,206 @@
 package apollo
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/mcdull-kk/pkg/codec"
 	"github.com/mcdull-kk/pkg/config"
-	"github.com/mcdull-kk/pkg/log"
 	"github.com/stretchr/testify/assert"
 )
 
+// fakeApollo is a stand-in of the Apollo config service, the gray
+// releases are served to the clients of their labels.
+type fakeApollo struct {
+	url string
+
+	mu            sync.Mutex
+	notifications map[string]int64
+	releases      map[string]map[string]string
+	grays         map[string]map[string]map[string]string
+}
+
+func newFakeApollo(t *testing.T) *fakeApollo {
+	f := &fakeApollo{
+		notifications: make(map[string]int64),
+		releases:      make(map[string]map[string]string),
+		grays:         make(map[string]map[string]map[string]string),
+	}
+	s := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(s.Close)
+	f.url = s.URL
+	return f
+}
+
+func (f *fakeApollo) release(ns string, values map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.releases[ns] = values
+	f.notifications[ns]++
+}
+
+func (f *fakeApollo) gray(ns, label string, values map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.grays[ns] == nil {
+		f.grays[ns] = make(map[string]map[string]string)
+	}
+	f.grays[ns][label] = values
+	f.notifications[ns]++
+}
+
+func (f *fakeApollo) values(ns, label string) map[string]string {
+	if values, ok := f.grays[ns][label]; ok {
+		return values
+	}
+	return f.releases[ns]
+}
+
+func (f *fakeApollo) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.URL.Path == "/services/config":
+		json.NewEncoder(w).Encode([]map[string]string{{"appName": "test", "instanceId": "test", "homepageUrl": f.url + "/"}})
+	case r.URL.Path == "/notifications/v2":
+		var (
+			notifications []map[string]any
+			changed       []map[string]any
+		)
+		json.Unmarshal([]byte(r.URL.Query().Get("notifications")), &notifications)
+		for _, n := range notifications {
+			ns := n["namespaceName"].(string)
+			if id := f.notifications[ns]; float64(id) > n["notificationId"].(float64) {
+				changed = append(changed, map[string]any{"namespaceName": ns, "notificationId": id})
+			}
+		}
+		if len(changed) == 0 {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		json.NewEncoder(w).Encode(changed)
+	case strings.HasPrefix(r.URL.Path, "/configfiles/json/"):
+		// the first sync of a client
+		json.NewEncoder(w).Encode(f.values(path.Base(r.URL.Path), r.URL.Query().Get("label")))
+	case strings.HasPrefix(r.URL.Path, "/configs/"):
+		ns := path.Base(r.URL.Path)
+		label := r.URL.Query().Get("label")
+		values := f.values(ns, label)
+		releaseKey := fmt.Sprintf("%d-%s", f.notifications[ns], label)
+		if releaseKey == r.URL.Query().Get("releaseKey") {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"appId":          "test",
+			"cluster":        "default",
+			"namespaceName":  ns,
+			"configurations": values,
+			"releaseKey":     releaseKey,
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
 func Test_apollo(t *testing.T) {
+	f := newFakeApollo(t)
+	f.release("application", map[string]string{"server.port": "8080", "server.name": "app"})
+	f.release("app.json", map[string]string{"content": `{"name":"app","debug":true}`})
+
 	apolloConfig := config.New(
 		config.WithSource(
 			NewSource(
-				WithOriginConfig(false),
-				WithAppID("default"),
-				WithCluster("dev"),
-				WithIP("http://81.68.181.139:8080"), // https://github.com/apolloconfig/apollo/tree/master/docs/zh
-				WithNamespace("application,event.yaml,demo.json"),
-				WithEnableBackup(),
-				WithSecret("8ed2960af452403a813414fbf966230c"),
+				WithOriginConfig(true),
+				WithAppID("test"),
+				WithCluster("default"),
+				WithIP(f.url),
+				WithNamespace("application,app.json"),
 			),
 		),
 	)
-
-	if err := apolloConfig.Load(); err != nil {
-		panic(err)
-	}
+	assert.Nil(t, apolloConfig.Load())
+	defer apolloConfig.Close(context.Background())
 
 	val := make(map[string]any)
 	err := apolloConfig.Scan(&val)
 	assert.Nil(t, err)
+	assert.Equal(t, int64(8080), apolloConfig.Value("application.server.port").IntOrDefault(0))
+	assert.Equal(t, "app", apolloConfig.Value("name").StringOrDefault(""))
 
-	v := apolloConfig.Value("application")
-	log.Info(v)
+	// the deleted keys are dropped by rebuilding the namespace
+	f.release("application", map[string]string{"server.port": "9090"})
+	assert.Eventually(t, func() bool {
+		return apolloConfig.Value("application.server.port").IntOrDefault(0) == 9090
+	}, 5*time.Second, 50*time.Millisecond)
+	_, err = apolloConfig.Value("application.server.name").String()
+	assert.Equal(t, config.ErrNotFound, err)
 
-	v = apolloConfig.Value("application.server.port")
-	log.Info(v)
+	f.release("app.json", map[string]string{"content": `{"name":"new"}`})
+	assert.Eventually(t, func() bool {
+		return apolloConfig.Value("name").StringOrDefault("") == "new"
+	}, 5*time.Second, 50*time.Millisecond)
+	_, err = apolloConfig.Value("debug").Bool()
+	assert.Equal(t, config.ErrNotFound, err)
+}
+
+func Test_grayRelease(t *testing.T) {
+	f := newFakeApollo(t)
+	f.release("gray", map[string]string{"name": "app"})
+	f.gray("gray", "canary", map[string]string{"name": "canary"})
+
+	newConfig := func(opts ...Option) config.Config {
+		opts = append(opts, WithAppID("test"), WithIP(f.url), WithNamespace("gray"))
+		c := config.New(config.WithSource(NewSource(opts...)))
+		assert.Nil(t, c.Load())
+		t.Cleanup(func() { c.Close(context.Background()) })
+		return c
+	}
+	canary := newConfig(WithLabel("canary"))
+	assert.Equal(t, "canary", canary.Value("gray.name").StringOrDefault(""))
+	stable := newConfig()
+	assert.Equal(t, "app", stable.Value("gray.name").StringOrDefault(""))
+
+	f.gray("gray", "canary", map[string]string{"name": "canary", "debug": "true"})
+	assert.Eventually(t, func() bool {
+		return canary.Value("gray.debug").BoolOrDefault(false)
+	}, 5*time.Second, 50*time.Millisecond)
+	_, err := stable.Value("gray.debug").Bool()
+	assert.Equal(t, config.ErrNotFound, err)
+}
+
+func Test_namespaceKeyValue(t *testing.T) {
+	a := &apollo{opt: &options{originConfig: true}}
+	kv, err := a.namespaceKeyValue("app.json", map[string]any{})
+	assert.Nil(t, err)
+	assert.Equal(t, &config.KeyValue{Key: "app.json", Deleted: true}, kv)
+	kv, err = a.namespaceKeyValue("application", map[string]any{})
+	assert.Nil(t, err)
+	assert.Equal(t, &config.KeyValue{Key: "application", Deleted: true}, kv)
+	kv, err = a.namespaceKeyValue("app.json", map[string]any{"content": `{}`})
+	assert.Nil(t, err)
+	assert.Equal(t, &config.KeyValue{Key: "app.json", Value: []byte(`{}`), Format: "json"}, kv)
+
+	// the parsed values of yaml keep their types, and the conflicting key is dropped
+	a = &apollo{opt: &options{}}
+	kv, err = a.namespaceKeyValue("app.yaml", map[string]any{"port": 8080, "log.level": "info", "log.level.root": "debug"})
+	assert.Nil(t, err)
+	assert.Equal(t, "json", kv.Format)
+	assert.JSONEq(t, `{"app":{"port":8080,"log":{"level":"info"}}}`, string(kv.Value))
+	kv, err = a.namespaceKeyValue("application", map[string]any{"log.level": "info", "log.level.root": "debug"})
+	assert.Nil(t, err)
+	assert.Equal(t, "properties", kv.Format)
+	var values map[string]any
+	assert.Nil(t, codec.GetCodec(kv.Format).Unmarshal(kv.Value, &values))
+	assert.Equal(t, map[string]any{"application": map[string]any{"log": map[string]any{"level": "info"}}}, values)
 }
 
 func Test_genKey(t *testing.T) {
@@ -89,12 +254,12 @@ func Test_format(t *testing.T) {
 		{
 			name:      "properties namespace",
 			namespace: "application",
-			want:      "json",
+			want:      "properties",
 		},
 		{
 			name:      "properties namespace #1",
 			namespace: "app.setting",
-			want:      "json",
+			want:      "properties",
 		},
 		{
 			name:      "namespace with format[yaml]",
@@ -155,3 +320,45 @@ func Test_resolve(t *testing.T) {
 		})
 	}
 }
+
+func Test_propertiesKeyValue(t *testing.T) {
+	tests := []struct {
+		ns     string
+		values map[string]any
+		want   map[string]any
+	}{
+		{
+			ns:     "application",
+			values: map[string]any{"aaa.bbb": "application"},
+			want: map[string]any{
+				"application": map[string]any{
+					"aaa": map[string]any{
+						"bbb": "application",
+					},
+				},
+			},
+		},
+		{
+			ns:     "app.properties",
+			values: map[string]any{"bbb.ccc": "aaabbbccc", "ddd": "a=b"},
+			want: map[string]any{
+				"app": map[string]any{
+					"bbb": map[string]any{
+						"ccc": "aaabbbccc",
+					},
+					"ddd": "a=b",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ns, func(t *testing.T) {
+			kv, err := propertiesKeyValue(tt.ns, tt.values)
+			assert.Nil(t, err)
+			target := make(map[string]any)
+			assert.Nil(t, codec.GetCodec(kv.Format).Unmarshal(kv.Value, &target))
+			assert.Equal(t, tt.want, target)
+		})
+	}
+}
@@ -64,3 +64,11 @@ func WithOriginConfig(originConfig bool) Option {
 		o.originConfig = originConfig
 	}
 }
+
+// WithLabel sets the gray release label of the client, the
+// gray release matching the label or the client ip is loaded.
+func WithLabel(label string) Option {
+	return func(o *options) {
+		o.Label = label
+	}
+}
@@ -2,10 +2,9 @@ package apollo
 
 import (
 	"context"
+	"sync"
 
-	"github.com/apolloconfig/agollo/v4/constant"
 	"github.com/apolloconfig/agollo/v4/storage"
-	"github.com/mcdull-kk/pkg/codec"
 	"github.com/mcdull-kk/pkg/config"
 	"github.com/mcdull-kk/pkg/log"
 )
@@ -23,15 +22,25 @@ type (
 	changeListener struct {
 		in     chan<- []*config.KeyValue
 		apollo *apollo
+		ctx    context.Context
+
+		mu sync.Mutex
+		// notifications are the last notification ids by namespace
+		notifications map[string]int64
 	}
 )
 
 func newWatcher(a *apollo) config.Watcher {
 	changeCh := make(chan []*config.KeyValue)
-	listener := &changeListener{in: changeCh, apollo: a}
+	ctx, cancel := context.WithCancel(context.Background())
+	listener := &changeListener{
+		in:            changeCh,
+		apollo:        a,
+		ctx:           ctx,
+		notifications: make(map[string]int64),
+	}
 	a.client.AddChangeListener(listener)
 
-	ctx, cancel := context.WithCancel(context.Background())
 	return &watcher{
 		out: changeCh,
 		ctx: ctx,
@@ -42,43 +51,29 @@ func newWatcher(a *apollo) config.Watcher {
 	}
 }
 
-func (l *changeListener) OnNewestChange(_ *storage.FullChangeEvent) {}
-
-func (l *changeListener) OnChange(event *storage.ChangeEvent) {
-	kv := make([]*config.KeyValue, 0, 2)
-	fm := configFileformat(event.Namespace)
+// OnChange is ignored, since the namespace is rebuilt by OnNewestChange
+// from its full snapshot, the DELETED keys are gone from the snapshot.
+func (l *changeListener) OnChange(_ *storage.ChangeEvent) {}
 
-	if fm == constant.JSON || fm == constant.YML || fm == constant.YAML || fm == constant.XML {
-		value, err := l.apollo.client.GetConfigCache(event.Namespace).Get("content")
-		if err != nil {
-			log.Warnw("apollo get config failed", "err", err)
-			return
-		}
-		kv = append(kv, &config.KeyValue{
-			Key:    event.Namespace,
-			Value:  []byte(value.(string)),
-			Format: format(event.Namespace),
-		})
-	} else {
-		next := make(map[string]any)
-		for key, change := range event.Changes {
-			resolve(genKey(event.Namespace, key), change.NewValue, next)
-		}
-		f := format(event.Namespace)
-		code := codec.GetCodec(f)
-		val, err := code.Marshal(next)
-		if err != nil {
-			log.Warnf("apollo could not handle namespace %s: %v", event.Namespace, err)
-			return
-		}
-		kv = append(kv, &config.KeyValue{
-			Key:    event.Namespace,
-			Value:  val,
-			Format: f,
-		})
+// OnNewestChange rebuilds the namespace from all of its newest values,
+// the events are delivered concurrently so the stale ones are dropped.
+func (l *changeListener) OnNewestChange(event *storage.FullChangeEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if last, ok := l.notifications[event.Namespace]; ok && event.NotificationID < last {
+		log.Debugf("apollo drops stale change of namespace %s: %d", event.Namespace, event.NotificationID)
+		return
+	}
+	kv, err := l.apollo.namespaceKeyValue(event.Namespace, event.Changes)
+	if err != nil {
+		log.Warnf("apollo could not handle namespace %s: %v", event.Namespace, err)
+		return
+	}
+	select {
+	case l.in <- []*config.KeyValue{kv}:
+		l.notifications[event.Namespace] = event.NotificationID
+	case <-l.ctx.Done():
 	}
-
-	l.in <- kv
 }
 
 // Next will be blocked until the Stop method is called
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultBackoffMin = time.Second
+	defaultBackoffMax = time.Minute
+)
+
+// backoff doubles the delay from min to max on every attempt,
+// the returned delay is jittered into [d/2, d].
+type backoff struct {
+	min     time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func (b *backoff) next() time.Duration {
+	d := b.max
+	if b.attempt < 62 && b.min<<b.attempt > 0 && b.min<<b.attempt < b.max { //nolint:gomnd
+		d = b.min << b.attempt
+		b.attempt++
+	}
+	half := int64(d / 2) //nolint:gomnd
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
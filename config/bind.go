@@ -0,0 +1,520 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mcdull-kk/pkg/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+type (
+	// Validator is implemented by config structs which validate
+	// themselves after all the tags are applied.
+	Validator interface {
+		Validate() error
+	}
+
+	// BindError reports all the violations found while binding.
+	BindError struct {
+		Errors []error
+	}
+
+	// fieldOptions is parsed from tag like
+	// `json:"name,optional,default=node,options=node|cluster,range=[0:10],env=NAME"`.
+	fieldOptions struct {
+		name       string
+		optional   bool
+		hasDefault bool
+		defaults   string
+		options    []string
+		bounds     *numberRange
+		env        string
+	}
+
+	numberRange struct {
+		left         float64
+		leftInclude  bool
+		leftSet      bool
+		right        float64
+		rightInclude bool
+		rightSet     bool
+	}
+
+	binder struct {
+		errs []error
+	}
+)
+
+func (e *BindError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// bindable reports whether v should be filled by the tag driven binder,
+// otherwise it is unmarshalled by the json codec.
+func bindable(v any) bool {
+	if _, ok := v.(proto.Message); ok {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Struct
+}
+
+// bind fills the struct pointed by v with values, honoring
+// default, optional, options, range and env field tags.
+func bind(values map[string]any, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bind target must be a non-nil pointer, got %v", reflect.TypeOf(v))
+	}
+	b := &binder{}
+	b.bindStruct("", values, rv.Elem())
+	if len(b.errs) > 0 {
+		return &BindError{Errors: b.errs}
+	}
+	if vd, ok := v.(Validator); ok {
+		return vd.Validate()
+	}
+	return nil
+}
+
+func (b *binder) fail(path string, format string, a ...any) {
+	b.errs = append(b.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, a...)))
+}
+
+func (b *binder) bindStruct(path string, values map[string]any, rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts, err := parseFieldOptions(field, tag)
+		if err != nil {
+			b.fail(joinPath(path, field.Name), "%v", err)
+			continue
+		}
+		fv := rv.Field(i)
+		// embedded struct without name is inlined
+		if field.Anonymous && tagName(tag) == "" {
+			if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						// unexported embedded pointer can not be allocated
+						continue
+					}
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				b.bindStruct(path, values, fv)
+				continue
+			}
+		}
+		b.bindField(joinPath(path, opts.name), values, fv, opts)
+	}
+}
+
+func (b *binder) bindField(path string, values map[string]any, fv reflect.Value, opts *fieldOptions) {
+	if !fv.CanSet() {
+		return
+	}
+	raw, ok := lookup(values, opts.name)
+	if opts.env != "" {
+		if ev, has := os.LookupEnv(opts.env); has {
+			raw, ok = ev, true
+		}
+	}
+	if !ok && opts.hasDefault {
+		raw, ok = opts.defaults, true
+	}
+	if !ok {
+		switch {
+		case opts.optional:
+		case fv.Kind() == reflect.Struct:
+			// nested struct may be fully covered by defaults
+			b.bindStruct(path, map[string]any{}, fv)
+		default:
+			b.fail(path, "field is required")
+		}
+		return
+	}
+
+	errs := len(b.errs)
+	b.assign(path, raw, fv)
+	if len(b.errs) > errs {
+		return
+	}
+	b.check(path, fv, opts)
+}
+
+// check validates the bound field value against options and range.
+func (b *binder) check(path string, fv reflect.Value, opts *fieldOptions) {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	if len(opts.options) > 0 {
+		val := codec.Repr(fv.Interface())
+		found := false
+		for _, o := range opts.options {
+			if o == val {
+				found = true
+				break
+			}
+		}
+		if !found {
+			b.fail(path, "value %q is not in options [%s]", val, strings.Join(opts.options, "|"))
+		}
+	}
+	if opts.bounds != nil {
+		var f float64
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			f = float64(fv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			f = float64(fv.Uint())
+		case reflect.Float32, reflect.Float64:
+			f = fv.Float()
+		default:
+			b.fail(path, "range is not supported on %v", fv.Type())
+			return
+		}
+		if !opts.bounds.contains(f) {
+			b.fail(path, "value %v is out of range %s", codec.Repr(fv.Interface()), opts.bounds)
+		}
+	}
+}
+
+func (b *binder) assign(path string, raw any, rv reflect.Value) {
+	if raw == nil {
+		return
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		b.assign(path, raw, rv.Elem())
+		return
+	}
+	if rv.Type() == durationType {
+		d, err := newValue(raw).Duration()
+		if err != nil {
+			b.fail(path, "%v", err)
+			return
+		}
+		rv.SetInt(int64(d))
+		return
+	}
+	if rv.CanAddr() {
+		if s, ok := raw.(string); ok && rv.Addr().Type().Implements(textUnmarshalerType) {
+			if err := rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				b.fail(path, "%v", err)
+			}
+			return
+		}
+		if rv.Addr().Type().Implements(jsonUnmarshalerType) {
+			data, err := json.Marshal(raw)
+			if err == nil {
+				err = rv.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(data)
+			}
+			if err != nil {
+				b.fail(path, "%v", err)
+			}
+			return
+		}
+	}
+
+	v := newValue(raw)
+	switch rv.Kind() {
+	case reflect.Struct:
+		m, ok := raw.(map[string]any)
+		if !ok {
+			b.fail(path, "expect object, got %T", raw)
+			return
+		}
+		b.bindStruct(path, m, rv)
+	case reflect.Map:
+		m, ok := raw.(map[string]any)
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			b.fail(path, "can not bind %T into %v", raw, rv.Type())
+			return
+		}
+		mv := reflect.MakeMapWithSize(rv.Type(), len(m))
+		for k, item := range m {
+			ev := reflect.New(rv.Type().Elem()).Elem()
+			b.assign(joinPath(path, k), item, ev)
+			mv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), ev)
+		}
+		rv.Set(mv)
+	case reflect.Slice:
+		items, ok := raw.([]any)
+		if s, isString := raw.(string); isString {
+			// default value of slice is written in json, like default=[1,2]
+			ok = json.Unmarshal([]byte(s), &items) == nil
+		}
+		if !ok {
+			b.fail(path, "expect array, got %T", raw)
+			return
+		}
+		sv := reflect.MakeSlice(rv.Type(), len(items), len(items))
+		for i, item := range items {
+			b.assign(fmt.Sprintf("%s[%d]", path, i), item, sv.Index(i))
+		}
+		rv.Set(sv)
+	case reflect.Interface:
+		if !reflect.TypeOf(raw).AssignableTo(rv.Type()) {
+			b.fail(path, "can not bind %T into %v", raw, rv.Type())
+			return
+		}
+		rv.Set(reflect.ValueOf(raw))
+	case reflect.String:
+		s, err := v.String()
+		if err != nil {
+			b.fail(path, "%v", err)
+			return
+		}
+		rv.SetString(s)
+	case reflect.Bool:
+		bv, err := v.Bool()
+		if err != nil {
+			b.fail(path, "%v", err)
+			return
+		}
+		rv.SetBool(bv)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !integral(raw) {
+			b.fail(path, "value %v is not an integer", raw)
+			return
+		}
+		i, err := v.Int()
+		if err != nil {
+			b.fail(path, "%v", err)
+			return
+		}
+		if rv.OverflowInt(i) {
+			b.fail(path, "value %d overflows %v", i, rv.Type())
+			return
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !integral(raw) {
+			b.fail(path, "value %v is not an integer", raw)
+			return
+		}
+		i, err := v.Int()
+		if err != nil {
+			b.fail(path, "%v", err)
+			return
+		}
+		if i < 0 || rv.OverflowUint(uint64(i)) {
+			b.fail(path, "value %d overflows %v", i, rv.Type())
+			return
+		}
+		rv.SetUint(uint64(i))
+	case reflect.Float32, reflect.Float64:
+		f, err := v.Float()
+		if err != nil {
+			b.fail(path, "%v", err)
+			return
+		}
+		rv.SetFloat(f)
+	default:
+		b.fail(path, "unsupported type %v", rv.Type())
+	}
+}
+
+// integral reports whether raw is not a float with fraction, which
+// is truncated by Value.Int.
+func integral(raw any) bool {
+	switch f := raw.(type) {
+	case float32:
+		return float64(f) == math.Trunc(float64(f))
+	case float64:
+		return f == math.Trunc(f)
+	}
+	return true
+}
+
+// lookup finds key in values, falls back to case-insensitive match
+// like encoding/json does.
+func lookup(values map[string]any, key string) (any, bool) {
+	if v, ok := values[key]; ok {
+		return v, true
+	}
+	for k, v := range values {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func tagName(tag string) string {
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		return tag[:idx]
+	}
+	return tag
+}
+
+func parseFieldOptions(field reflect.StructField, tag string) (*fieldOptions, error) {
+	opts := &fieldOptions{name: tagName(tag)}
+	if opts.name == "" {
+		opts.name = tagName(field.Tag.Get("yaml"))
+	}
+	if opts.name == "" {
+		opts.name = field.Name
+	}
+	for _, seg := range splitTag(tag)[1:] {
+		seg = strings.TrimSpace(seg)
+		key, val, _ := strings.Cut(seg, "=")
+		switch key {
+		case "optional":
+			opts.optional = true
+		case "default":
+			opts.hasDefault = true
+			opts.defaults = val
+		case "options":
+			opts.options = strings.Split(val, "|")
+		case "range":
+			bounds, err := parseNumberRange(val)
+			if err != nil {
+				return nil, err
+			}
+			opts.bounds = bounds
+		case "env":
+			opts.env = val
+		}
+	}
+	return opts, nil
+}
+
+// splitTag splits tag by comma, commas inside brackets are kept.
+func splitTag(tag string) []string {
+	var (
+		segs  []string
+		depth int
+		start int
+	)
+	for i, r := range tag {
+		switch r {
+		case '[', '(':
+			depth++
+		case ']', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				segs = append(segs, tag[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segs, tag[start:])
+}
+
+// parseNumberRange parses range like [1:10], (0:1], [5:].
+func parseNumberRange(s string) (*numberRange, error) {
+	if len(s) < 3 { //nolint:gomnd
+		return nil, fmt.Errorf("invalid range %q", s)
+	}
+	nr := &numberRange{}
+	switch s[0] {
+	case '[':
+		nr.leftInclude = true
+	case '(':
+	default:
+		return nil, fmt.Errorf("invalid range %q", s)
+	}
+	switch s[len(s)-1] {
+	case ']':
+		nr.rightInclude = true
+	case ')':
+	default:
+		return nil, fmt.Errorf("invalid range %q", s)
+	}
+	left, right, ok := strings.Cut(s[1:len(s)-1], ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid range %q", s)
+	}
+	var err error
+	if left = strings.TrimSpace(left); left != "" {
+		if nr.left, err = strconv.ParseFloat(left, 64); err != nil {
+			return nil, fmt.Errorf("invalid range %q", s)
+		}
+		nr.leftSet = true
+	}
+	if right = strings.TrimSpace(right); right != "" {
+		if nr.right, err = strconv.ParseFloat(right, 64); err != nil {
+			return nil, fmt.Errorf("invalid range %q", s)
+		}
+		nr.rightSet = true
+	}
+	if nr.leftSet && nr.rightSet && nr.left > nr.right {
+		return nil, errors.New("range left bound is greater than right bound")
+	}
+	return nr, nil
+}
+
+func (r *numberRange) contains(f float64) bool {
+	if r.leftSet && (f < r.left || !r.leftInclude && f == r.left) {
+		return false
+	}
+	if r.rightSet && (f > r.right || !r.rightInclude && f == r.right) {
+		return false
+	}
+	return true
+}
+
+func (r *numberRange) String() string {
+	var sb strings.Builder
+	if r.leftInclude {
+		sb.WriteByte('[')
+	} else {
+		sb.WriteByte('(')
+	}
+	if r.leftSet {
+		sb.WriteString(strconv.FormatFloat(r.left, 'f', -1, 64))
+	}
+	sb.WriteByte(':')
+	if r.rightSet {
+		sb.WriteString(strconv.FormatFloat(r.right, 'f', -1, 64))
+	}
+	if r.rightInclude {
+		sb.WriteByte(']')
+	} else {
+		sb.WriteByte(')')
+	}
+	return sb.String()
+}
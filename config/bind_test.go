@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	testRedisConf struct {
+		Addr string `yaml:"addr" json:"addr"`
+		Type string `yaml:"type" json:",default=node,options=node|cluster"`
+		Pass string `yaml:"pass" json:",optional"`
+		DB   int    `json:"db,default=0,range=[0:16)"`
+	}
+
+	testServerConf struct {
+		Name    string            `json:"name"`
+		Port    int               `json:"port,env=TEST_BIND_PORT"`
+		Timeout time.Duration     `json:"timeout,default=1s"`
+		Rate    float64           `json:"rate,default=1.0,range=[0:1]"`
+		Tags    []string          `json:"tags,default=[\"a\",\"b\"]"`
+		Labels  map[string]string `json:"labels,optional"`
+		Redis   testRedisConf     `json:"redis"`
+	}
+)
+
+func (c *testServerConf) Validate() error {
+	if c.Port == 0 {
+		return errors.New("port must not be zero")
+	}
+	return nil
+}
+
+func TestBind(t *testing.T) {
+	values := map[string]any{
+		"name": "mcdull",
+		"Port": "8080",
+		"labels": map[string]any{
+			"zone": "sh",
+		},
+		"redis": map[string]any{
+			"addr": "127.0.0.1:6379",
+			"db":   float64(1),
+		},
+	}
+	var conf testServerConf
+	err := bind(values, &conf)
+	assert.Nil(t, err)
+	assert.Equal(t, "mcdull", conf.Name)
+	assert.Equal(t, 8080, conf.Port)
+	assert.Equal(t, time.Second, conf.Timeout)
+	assert.Equal(t, 1.0, conf.Rate)
+	assert.Equal(t, []string{"a", "b"}, conf.Tags)
+	assert.Equal(t, map[string]string{"zone": "sh"}, conf.Labels)
+	assert.Equal(t, "node", conf.Redis.Type)
+	assert.Equal(t, 1, conf.Redis.DB)
+
+	os.Setenv("TEST_BIND_PORT", "9090")
+	defer os.Unsetenv("TEST_BIND_PORT")
+	assert.Nil(t, bind(values, &conf))
+	assert.Equal(t, 9090, conf.Port)
+}
+
+func TestBind_Violations(t *testing.T) {
+	values := map[string]any{
+		"port": 0,
+		"rate": 1.5,
+		"redis": map[string]any{
+			"type": "sentinel",
+			"db":   16,
+		},
+	}
+	var conf testServerConf
+	err := bind(values, &conf)
+	var be *BindError
+	assert.True(t, errors.As(err, &be))
+	assert.Len(t, be.Errors, 5)
+	assert.Contains(t, err.Error(), "name: field is required")
+	assert.Contains(t, err.Error(), "rate: value 1.5 is out of range [0:1]")
+	assert.Contains(t, err.Error(), "redis.addr: field is required")
+	assert.Contains(t, err.Error(), `redis.type: value "sentinel" is not in options [node|cluster]`)
+	assert.Contains(t, err.Error(), "redis.db: value 16 is out of range [0:16)")
+
+	values = map[string]any{
+		"name":  "mcdull",
+		"port":  0,
+		"redis": map[string]any{"addr": "127.0.0.1:6379"},
+	}
+	err = bind(values, &conf)
+	assert.EqualError(t, err, "port must not be zero")
+
+	values["port"] = "abc"
+	err = bind(values, &conf)
+	assert.True(t, errors.As(err, &be))
+
+	values["port"] = 1.5
+	err = bind(values, &conf)
+	assert.EqualError(t, err, "port: value 1.5 is not an integer")
+}
+
+func TestBind_Embedded(t *testing.T) {
+	values := map[string]any{"name": "mcdull", "addr": "127.0.0.1:6379"}
+	type unexported struct {
+		Addr string `json:"addr"`
+	}
+	var private struct {
+		*unexported
+		Name string `json:"name"`
+	}
+	assert.Nil(t, bind(values, &private))
+	assert.Equal(t, "mcdull", private.Name)
+	assert.Nil(t, private.unexported)
+}
+
+func TestParseNumberRange(t *testing.T) {
+	tests := []struct {
+		input string
+		in    []float64
+		out   []float64
+	}{
+		{input: "[1:10]", in: []float64{1, 5, 10}, out: []float64{0, 11}},
+		{input: "(1:10)", in: []float64{2, 9}, out: []float64{1, 10}},
+		{input: "[5:]", in: []float64{5, 100}, out: []float64{4}},
+		{input: "(:0]", in: []float64{-1, 0}, out: []float64{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			r, err := parseNumberRange(tt.input)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.input, r.String())
+			for _, f := range tt.in {
+				assert.True(t, r.contains(f))
+			}
+			for _, f := range tt.out {
+				assert.False(t, r.contains(f))
+			}
+		})
+	}
+
+	for _, input := range []string{"", "1:10", "[1,10]", "[a:1]", "[10:1]"} {
+		_, err := parseNumberRange(input)
+		assert.NotNil(t, err)
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+type (
+	// Change is a single leaf path changed between two merged configs,
+	// Old is nil for added paths and New is nil for deleted paths.
+	Change struct {
+		Path string `json:"path"`
+		Old  any    `json:"old,omitempty"`
+		New  any    `json:"new,omitempty"`
+	}
+
+	// ChangeSet groups the changes between two merged configs.
+	ChangeSet struct {
+		Added    []Change `json:"added,omitempty"`
+		Modified []Change `json:"modified,omitempty"`
+		Deleted  []Change `json:"deleted,omitempty"`
+	}
+
+	// ChangeObserver is notified with changes under the watched prefix.
+	ChangeObserver func(prefix string, cs *ChangeSet)
+)
+
+// Empty reports whether there is no change at all.
+func (cs *ChangeSet) Empty() bool {
+	return len(cs.Added) == 0 && len(cs.Modified) == 0 && len(cs.Deleted) == 0
+}
+
+// Prefix returns the changes whose path is prefix or under prefix,
+// prefix "redis" and "redis." both match "redis.addr" but not "redisx".
+func (cs *ChangeSet) Prefix(prefix string) *ChangeSet {
+	prefix = strings.TrimSuffix(prefix, ".")
+	if prefix == "" {
+		return cs
+	}
+	match := func(changes []Change) []Change {
+		var matched []Change
+		for _, c := range changes {
+			if c.Path == prefix || strings.HasPrefix(c.Path, prefix+".") {
+				matched = append(matched, c)
+			}
+		}
+		return matched
+	}
+	return &ChangeSet{
+		Added:    match(cs.Added),
+		Modified: match(cs.Modified),
+		Deleted:  match(cs.Deleted),
+	}
+}
+
+// diff compares leaf values of prev and next by dotted path,
+// arrays are compared as a whole.
+func diff(prev, next map[string]any) *ChangeSet {
+	var (
+		cs     = &ChangeSet{}
+		before = make(map[string]any)
+		after  = make(map[string]any)
+	)
+	flatten("", prev, before)
+	flatten("", next, after)
+	for _, path := range sortedKeys(after) {
+		nv := after[path]
+		ov, ok := before[path]
+		switch {
+		case !ok:
+			cs.Added = append(cs.Added, Change{Path: path, New: nv})
+		case !reflect.DeepEqual(ov, nv):
+			cs.Modified = append(cs.Modified, Change{Path: path, Old: ov, New: nv})
+		}
+	}
+	for _, path := range sortedKeys(before) {
+		if _, ok := after[path]; !ok {
+			cs.Deleted = append(cs.Deleted, Change{Path: path, Old: before[path]})
+		}
+	}
+	return cs
+}
+
+func flatten(path string, values map[string]any, target map[string]any) {
+	for k, v := range values {
+		key := joinPath(path, k)
+		if sub, ok := v.(map[string]any); ok && len(sub) > 0 {
+			flatten(key, sub, target)
+			continue
+		}
+		target[key] = v
+	}
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	prev := map[string]any{
+		"name": "mcdull",
+		"redis": map[string]any{
+			"addr": "127.0.0.1:6379",
+			"db":   1,
+		},
+		"hosts": []any{"a", "b"},
+	}
+	next := map[string]any{
+		"name": "mcdull",
+		"redis": map[string]any{
+			"addr": "127.0.0.1:6380",
+			"pass": "foo",
+		},
+		"hosts": []any{"a"},
+	}
+	cs := diff(prev, next)
+	assert.Equal(t, []Change{{Path: "redis.pass", New: "foo"}}, cs.Added)
+	assert.Equal(t, []Change{
+		{Path: "hosts", Old: []any{"a", "b"}, New: []any{"a"}},
+		{Path: "redis.addr", Old: "127.0.0.1:6379", New: "127.0.0.1:6380"},
+	}, cs.Modified)
+	assert.Equal(t, []Change{{Path: "redis.db", Old: 1}}, cs.Deleted)
+
+	sub := cs.Prefix("redis.")
+	assert.Len(t, sub.Added, 1)
+	assert.Len(t, sub.Modified, 1)
+	assert.Len(t, sub.Deleted, 1)
+	assert.True(t, cs.Prefix("redi").Empty())
+	assert.Equal(t, cs, cs.Prefix(""))
+	assert.True(t, diff(next, next).Empty())
+}
+
+func TestConfig_WatchPrefix(t *testing.T) {
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"redis":{"addr":"127.0.0.1:6379"},"name":"mcdull"}`)})
+	c := New(WithSource(src))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	var got *ChangeSet
+	c.WatchPrefix("redis.", func(prefix string, cs *ChangeSet) {
+		assert.Equal(t, "redis.", prefix)
+		got = cs
+	})
+
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"redis":{"addr":"127.0.0.1:6379","db":2},"name":"kk"}`)})
+	assert.NotNil(t, got)
+	assert.Equal(t, []Change{{Path: "redis.db", New: float64(2)}}, got.Added)
+	assert.Empty(t, got.Modified)
+	assert.Empty(t, got.Deleted)
+
+	got = nil
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"redis":{"addr":"127.0.0.1:6379","db":2},"name":"mcdull"}`)})
+	assert.Nil(t, got)
+
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull"}`)})
+	assert.Equal(t, []Change{
+		{Path: "redis.addr", Old: "127.0.0.1:6379"},
+		{Path: "redis.db", Old: float64(2)},
+	}, got.Deleted)
+}
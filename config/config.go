@@ -4,9 +4,10 @@ package config
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/mcdull-kk/pkg/codec"
@@ -22,80 +23,199 @@ var (
 
 type (
 	// Observer is config observer.
-	Observer func(string, *atomic.Value)
+	Observer func(string, Value)
 
 	Config interface {
 		Load() error
 		Scan(v interface{}) error
-		Value(key string) *atomic.Value
-		Watch(key string, o Observer) error
-		Close() error
+		ScanWatch(v any, o ScanObserver) error
+		Value(key string) Value
+		Origin(key string) (string, bool)
+		Dump() ([]byte, error)
+		Watch(key string, o Observer) (Cancel, error)
+		WatchPrefix(prefix string, o ChangeObserver) Cancel
+		Snapshot() *Snapshot
+		History() []*Snapshot
+		Diff(v1, v2 uint64) (*ChangeSet, error)
+		Rollback(version uint64) error
+		Sources() []SourceStatus
+		Close(ctx context.Context) error
+	}
+
+	// SourceStatus is the load state of a source.
+	SourceStatus struct {
+		Name     string    `json:"name"`
+		Priority int       `json:"priority"`
+		Strategy string    `json:"strategy"`
+		Loaded   bool      `json:"loaded"`
+		Error    string    `json:"error,omitempty"`
+		Updated  time.Time `json:"updated"`
+		// Healthy reports whether the watcher works,
+		// Failures counts its consecutive failures.
+		Healthy  bool `json:"healthy"`
+		Failures int  `json:"failures"`
 	}
 
 	config struct {
 		opts      options
 		reader    Reader
 		cached    sync.Map
-		observers sync.Map
-		watchers  []Watcher
+		observers observers
+		watchers  []*watching
+		done      chan struct{}
+		closeOnce sync.Once
+		closeErr  error
+		loops     sync.WaitGroup
+		// exited is closed once the watch loops exit after Close
+		exited   chan struct{}
+		lock     sync.Mutex
+		scanLock sync.Mutex
+		scanners []*scanner
+		// fallback holds the sources loaded from the snapshot
+		// file, which have not delivered any update yet
+		fallback map[string]struct{}
+		status   []*SourceStatus
+		statLock sync.RWMutex
 	}
 )
 
+// CloseError reports all the errors of stopping watchers and closing sources.
+type CloseError struct {
+	Errors []error
+}
+
+func (e *CloseError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors matches target.
+func (e *CloseError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
 // New a config with options.
 func New(opts ...Option) Config {
 	o := options{
-		decoder:  defaultDecoder,
-		resolver: defaultResolver,
+		decoder:    defaultDecoder,
+		resolver:   defaultResolver,
+		history:    defaultHistory,
+		backoffMin: defaultBackoffMin,
+		backoffMax: defaultBackoffMax,
+		secrets: map[string]SecretProvider{
+			"file": NewFileSecretProvider(),
+		},
 	}
 	for _, opt := range opts {
 		opt(&o)
 	}
-	return &config{
-		opts:   o,
-		reader: newReader(o),
+	c := &config{
+		opts:     o,
+		reader:   newReader(o),
+		fallback: make(map[string]struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, src := range o.sources {
+		c.status = append(c.status, &SourceStatus{
+			Name:     src.name,
+			Priority: src.priority,
+			Strategy: src.strategy.String(),
+		})
 	}
+	return c
 }
 
 func (c *config) Load() error {
 	for _, src := range c.opts.sources {
 		kvs, err := src.Load()
+		c.setStatus(src.name, err)
 		if err != nil {
-			return err
+			if c.loadSnapshot() != nil {
+				return err
+			}
+			log.Errorf("failed to load config source %s, using snapshot: %v", src.name, err)
+			c.fallback[src.name] = struct{}{}
 		}
 		for _, v := range kvs {
 			log.Debugf("config loaded: %s format: %s", v.Key, v.Format)
 		}
-		if err = c.reader.Merge(kvs...); err != nil {
+		if err = c.reader.Merge(src.name, kvs...); err != nil {
 			log.Errorf("failed to merge config source: %v", err)
 			return err
 		}
 		w, err := src.Watch()
+		c.setHealth(src.name, err)
 		if err != nil {
 			log.Errorf("failed to watch config source: %v", err)
-			return err
+			if _, ok := c.fallback[src.name]; !ok {
+				return err
+			}
+			// reconnected in background
+			w = nil
 		}
-		c.watchers = append(c.watchers, w)
-		c.watch(w)
+		c.watchers = append(c.watchers, &watching{src: src, w: w})
+	}
+	// the loops start after all the sources are loaded, since a
+	// reconnected source drops its fallback which is written above
+	for _, ws := range c.watchers {
+		c.watch(ws)
 	}
 	if err := c.reader.Resolve(); err != nil {
 		log.Errorf("failed to resolve config source: %v", err)
+		observeValidation("load", err)
 		return err
 	}
 	return nil
 }
 
-func (c *config) Value(key string) *atomic.Value {
+// loadSnapshot merges the snapshot file as the lowest layer once.
+func (c *config) loadSnapshot() error {
+	if c.opts.snapshotFile == "" {
+		return errors.New("no snapshot file")
+	}
+	if len(c.fallback) > 0 {
+		return nil
+	}
+	kv, err := loadSnapshot(c.opts.snapshotFile)
+	if err != nil {
+		log.Errorf("failed to load config snapshot: %v", err)
+		return err
+	}
+	return c.reader.Merge(snapshotLayer, kv)
+}
+
+// Value returns the Value of key, the returned Value reports
+// ErrNotFound from every accessor if key does not exist.
+func (c *config) Value(key string) Value {
 	if v, ok := c.cached.Load(key); ok {
-		return v.(*atomic.Value)
+		return v.(Value)
 	}
 	if v, ok := c.reader.Value(key); ok {
 		c.cached.Store(key, v)
 		return v
 	}
-	return nil
+	return errValue{err: ErrNotFound}
 }
 
+// Scan binds the merged config into v. A pointer to struct is filled
+// by field tags, see bind, any other target is decoded by json codec.
 func (c *config) Scan(v any) error {
+	if bindable(v) {
+		values, err := c.reader.Values()
+		if err != nil {
+			return err
+		}
+		return bind(values, v)
+	}
+
 	data, err := c.reader.Source()
 	if err != nil {
 		return err
@@ -104,55 +224,243 @@ func (c *config) Scan(v any) error {
 	return codec.GetCodec(codec.JsonName).Unmarshal(data, v)
 }
 
-func (c *config) Watch(key string, o Observer) error {
-	if v := c.Value(key); v.Load() == nil {
-		return ErrNotFound
+// Origin returns the name of the source which the leaf key came from,
+// see WithSourceName.
+func (c *config) Origin(key string) (string, bool) {
+	return c.reader.Origin(key)
+}
+
+// Dump returns the merged config in json with secrets redacted.
+func (c *config) Dump() ([]byte, error) {
+	return codec.GetCodec(codec.JsonName).Marshal(c.reader.Redacted())
+}
+
+// ScanWatch binds the merged config into v like Scan and re-binds a new
+// struct of the same type after every config change. The new snapshot is
+// handed to o only if binding and validation pass, v itself is never
+// modified after ScanWatch returns.
+func (c *config) ScanWatch(v any, o ScanObserver) error {
+	if !bindable(v) {
+		return errNotBindable
+	}
+	c.scanLock.Lock()
+	defer c.scanLock.Unlock()
+	if err := c.Scan(v); err != nil {
+		return err
 	}
-	c.observers.Store(key, o)
+	s := &scanner{typ: reflect.TypeOf(v).Elem(), observer: o}
+	s.current.Store(v)
+	c.scanners = append(c.scanners, s)
+	func() {
+		defer rescue.Recover()
+		o(nil, v)
+	}()
 	return nil
 }
 
-func (c *config) Close() error {
-	for _, w := range c.watchers {
-		if err := w.Stop(); err != nil {
-			return err
+// Watch observes key, any number of observers can watch the same key
+// and they are called in registration order.
+func (c *config) Watch(key string, o Observer) (Cancel, error) {
+	// a null value exists, only the missing key is errValue,
+	// the found value is cached to be notified by publish
+	if _, ok := c.Value(key).(errValue); ok {
+		return nil, ErrNotFound
+	}
+	return c.observers.add(&subscription{key: key, value: o}), nil
+}
+
+// WatchPrefix observes every added, modified and deleted path
+// under prefix, empty prefix observes the whole config.
+func (c *config) WatchPrefix(prefix string, o ChangeObserver) Cancel {
+	return c.observers.add(&subscription{key: prefix, change: o})
+}
+
+// Snapshot returns the latest version of the merged config.
+func (c *config) Snapshot() *Snapshot {
+	history := c.reader.History()
+	if len(history) == 0 {
+		return &Snapshot{Values: map[string]any{}}
+	}
+	return history[len(history)-1]
+}
+
+// History returns the kept versions from the oldest to the latest, see WithHistory.
+func (c *config) History() []*Snapshot {
+	return c.reader.History()
+}
+
+// Diff returns the changes from version v1 to v2.
+func (c *config) Diff(v1, v2 uint64) (*ChangeSet, error) {
+	return c.reader.Diff(v1, v2)
+}
+
+// Rollback restores the merged config of version as a new version
+// and notifies the observers, later updates are merged on top of it.
+func (c *config) Rollback(version uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	prev, err := c.reader.Values()
+	if err != nil {
+		return err
+	}
+	if err := c.reader.Rollback(version); err != nil {
+		return err
+	}
+	return c.publish(prev)
+}
+
+// Sources returns the load state of the sources in registration order.
+func (c *config) Sources() []SourceStatus {
+	c.statLock.RLock()
+	defer c.statLock.RUnlock()
+	status := make([]SourceStatus, 0, len(c.status))
+	for _, st := range c.status {
+		status = append(status, *st)
+	}
+	return status
+}
+
+func (c *config) setStatus(name string, err error) {
+	c.statLock.Lock()
+	defer c.statLock.Unlock()
+	for _, st := range c.status {
+		if st.Name != name {
+			continue
+		}
+		if err != nil {
+			st.Error = err.Error()
+			return
 		}
+		st.Loaded = true
+		st.Error = ""
+		st.Updated = time.Now()
 	}
-	return nil
 }
 
-func (c *config) watch(w Watcher) {
-	rescue.GoSafe(func() {
-		for {
-			kvs, err := w.Next()
-			if err != nil {
-				if errors.Is(err, context.Canceled) {
-					log.Infof("watcher's ctx cancel : %v", err)
-					return
-				}
-				time.Sleep(time.Second)
-				log.Errorf("failed to watch next config: %v", err)
-				continue
-			}
-			if err := c.reader.Merge(kvs...); err != nil {
-				log.Errorf("failed to merge next config: %v", err)
-				continue
+func (c *config) setHealth(name string, err error) {
+	c.statLock.Lock()
+	defer c.statLock.Unlock()
+	for _, st := range c.status {
+		if st.Name != name {
+			continue
+		}
+		if err != nil {
+			st.Healthy = false
+			st.Failures++
+			st.Error = err.Error()
+			metricSourceHealthy.Set(0, name)
+			return
+		}
+		st.Healthy = true
+		st.Failures = 0
+		metricSourceHealthy.Set(1, name)
+	}
+}
+
+// Close stops all the watchers, closes all the sources and waits until
+// the watch loops exit or ctx is done. The errors of stopping and closing
+// are reported together by CloseError, it is safe to call Close more than once.
+func (c *config) Close(ctx context.Context) error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.exited = make(chan struct{})
+		go func() {
+			c.loops.Wait()
+			close(c.exited)
+		}()
+		var errs []error
+		for _, ws := range c.watchers {
+			if err := ws.stop(); err != nil {
+				errs = append(errs, fmt.Errorf("stop watcher of %s: %w", ws.src.name, err))
 			}
-			if err := c.reader.Resolve(); err != nil {
-				log.Errorf("failed to resolve next config: %v", err)
-				continue
+		}
+		for _, src := range c.opts.sources {
+			if err := src.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close source %s: %w", src.name, err))
 			}
-			c.cached.Range(func(key, value interface{}) bool {
-				k := key.(string)
-				v := value.(*atomic.Value)
-				if n, ok := c.reader.Value(k); ok && reflect.TypeOf(n.Load()) == reflect.TypeOf(v.Load()) && !reflect.DeepEqual(n.Load(), v.Load()) {
-					v.Store(n.Load())
-					if o, ok := c.observers.Load(k); ok {
-						o.(Observer)(k, v)
-					}
-				}
-				return true
-			})
+		}
+		if len(errs) > 0 {
+			c.closeErr = &CloseError{Errors: errs}
 		}
 	})
+	select {
+	case <-c.exited:
+		return c.closeErr
+	case <-ctx.Done():
+		if c.closeErr != nil {
+			return &CloseError{Errors: append(append([]error(nil), c.closeErr.(*CloseError).Errors...), ctx.Err())}
+		}
+		return ctx.Err()
+	}
+}
+
+// apply merges kvs of src and notifies the observers with what changed,
+// updates from different sources are applied one by one. The layer of
+// src is replaced as a whole if full is true, like after reconnect.
+func (c *config) apply(src *source, kvs []*KeyValue, full bool) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	prev, err := c.reader.Values()
+	if err != nil {
+		return err
+	}
+	if full {
+		c.reader.Remove(src.name)
+	}
+	if err = c.reader.Merge(src.name, kvs...); err != nil {
+		c.setStatus(src.name, err)
+		return err
+	}
+	if _, ok := c.fallback[src.name]; ok {
+		// the source is back, drop the snapshot once all are back
+		delete(c.fallback, src.name)
+		if len(c.fallback) == 0 {
+			c.reader.Remove(snapshotLayer)
+		}
+	}
+	err = c.reader.Resolve()
+	c.setStatus(src.name, err)
+	if err != nil {
+		observeValidation(src.name, err)
+		return err
+	}
+	return c.publish(prev)
+}
+
+// publish notifies the observers with the changes from prev
+// to the merged config, it must be called with c.lock held.
+func (c *config) publish(prev map[string]any) error {
+	next, err := c.reader.Values()
+	if err != nil {
+		return err
+	}
+	c.cached.Range(func(key, value interface{}) bool {
+		k := key.(string)
+		v := value.(Value)
+		n, ok := readValue(next, k)
+		if !ok {
+			c.cached.Delete(k)
+			return true
+		}
+		nt, vt := reflect.TypeOf(n.Load()), reflect.TypeOf(v.Load())
+		// a null leaf is nil, it changes the value of any type
+		if (nt == vt || nt == nil || vt == nil) && !reflect.DeepEqual(n.Load(), v.Load()) {
+			v.Store(n.Load())
+			c.observers.notifyKey(k, v)
+		}
+		return true
+	})
+	if cs := diff(prev, next); !cs.Empty() {
+		c.observers.notifyChange(cs)
+	}
+	c.rescan(next)
+	return nil
+}
+
+func (c *config) rescan(values map[string]any) {
+	c.scanLock.Lock()
+	defer c.scanLock.Unlock()
+	for _, s := range c.scanners {
+		s.rescan(values)
+	}
 }
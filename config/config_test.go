@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"reflect"
 	"strings"
 	"testing"
@@ -46,6 +47,36 @@ func Test_defaultDecoder(t *testing.T) {
 				"name": "alias",
 			},
 		},
+		{
+			keyValue: &KeyValue{
+				Key:    "app.toml",
+				Value:  []byte("[server]\nport = 8080"),
+				Format: "toml",
+			},
+			want: map[string]interface{}{
+				"server": map[string]interface{}{"port": int64(8080)},
+			},
+		},
+		{
+			keyValue: &KeyValue{
+				Key:    "app.properties",
+				Value:  []byte("server.port=8080"),
+				Format: "properties",
+			},
+			want: map[string]interface{}{
+				"server": map[string]interface{}{"port": "8080"},
+			},
+		},
+		{
+			keyValue: &KeyValue{
+				Key:    "app.ini",
+				Value:  []byte("[server]\nport = 8080"),
+				Format: "ini",
+			},
+			want: map[string]interface{}{
+				"server": map[string]interface{}{"port": "8080"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -213,3 +244,107 @@ func TestExpand(t *testing.T) {
 		assert.Equal(t, tt.want, expand(tt.input, tt.mapping))
 	}
 }
+
+type (
+	testSource struct {
+		kvs []*KeyValue
+		ch  chan []*KeyValue
+	}
+
+	testWatcher struct {
+		ch   chan []*KeyValue
+		done chan struct{}
+	}
+)
+
+func newTestSource(kvs ...*KeyValue) *testSource {
+	return &testSource{kvs: kvs, ch: make(chan []*KeyValue)}
+}
+
+func (s *testSource) Load() ([]*KeyValue, error) { return s.kvs, nil }
+func (s *testSource) Close() error               { return nil }
+func (s *testSource) Watch() (Watcher, error) {
+	return &testWatcher{ch: s.ch, done: make(chan struct{})}, nil
+}
+
+// push delivers kvs to the watcher and waits until they are applied.
+func (s *testSource) push(kvs ...*KeyValue) {
+	s.ch <- kvs
+	s.ch <- nil
+}
+
+func (w *testWatcher) Next() ([]*KeyValue, error) {
+	for {
+		select {
+		case kvs := <-w.ch:
+			if kvs == nil {
+				continue
+			}
+			return kvs, nil
+		case <-w.done:
+			return nil, context.Canceled
+		}
+	}
+}
+
+func (w *testWatcher) Stop() error {
+	close(w.done)
+	return nil
+}
+
+func TestConfig_ScanWatch(t *testing.T) {
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"redis":{"addr":"127.0.0.1:6379","db":1}}`)})
+	c := New(WithSource(src))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	type conf struct {
+		Redis testRedisConf `json:"redis"`
+	}
+	var changes int
+	w, err := NewWatched(c, func(old, new *conf) {
+		changes++
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "node", w.Load().Redis.Type)
+	assert.Equal(t, 1, w.Load().Redis.DB)
+
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"redis":{"addr":"127.0.0.1:6379","db":2}}`)})
+	assert.Equal(t, 2, w.Load().Redis.DB)
+	assert.Equal(t, 1, changes)
+
+	// invalid snapshot is dropped and the last good one is kept
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"redis":{"addr":"127.0.0.1:6379","type":"sentinel"}}`)})
+	assert.Equal(t, "node", w.Load().Redis.Type)
+	assert.Equal(t, 2, w.Load().Redis.DB)
+	assert.Equal(t, 1, changes)
+
+	assert.Equal(t, errNotBindable, c.ScanWatch(map[string]any{}, func(old, new any) {}))
+}
+
+func TestConfig_Watch(t *testing.T) {
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull"}`)})
+	c := New(WithSource(src))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	var calls []string
+	_, err := c.Watch("name", func(key string, v Value) {
+		calls = append(calls, "first")
+		panic("observer panic")
+	})
+	assert.Nil(t, err)
+	cancel, err := c.Watch("name", func(key string, v Value) {
+		calls = append(calls, "second:"+v.StringOrDefault(""))
+	})
+	assert.Nil(t, err)
+
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"kk"}`)})
+	assert.Equal(t, []string{"first", "second:kk"}, calls)
+
+	cancel()
+	cancel()
+	calls = nil
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull"}`)})
+	assert.Equal(t, []string{"first"}, calls)
+}
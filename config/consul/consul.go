@@ -2,17 +2,32 @@ package consul
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/consul/api"
+	"github.com/mcdull-kk/pkg/codec"
 	"github.com/mcdull-kk/pkg/config"
 )
 
+// ErrPermissionDenied is returned if the ACL token is not allowed to read the path.
+var ErrPermissionDenied = errors.New("consul permission denied")
+
 type (
 	consul struct {
 		client  *api.Client
 		options *options
+
+		mu sync.Mutex
+		// index is the X-Consul-Index of the last list
+		index uint64
+		// sums are the checksums of the listed values by key
+		sums map[string]uint64
 	}
 )
 
@@ -42,27 +57,113 @@ func NewSource(opts ...Option) config.Source {
 }
 
 func (c *consul) Load() (kv []*config.KeyValue, err error) {
-	kvs, _, err := c.client.KV().List(c.options.path, nil)
+	pairs, index, err := c.list(c.options.ctx, 0)
 	if err != nil {
 		return nil, err
 	}
-	pathPrefix := c.options.path
-	if !strings.HasPrefix(c.options.path, "/") {
-		pathPrefix += "/"
+	kv = make([]*config.KeyValue, 0, len(pairs))
+	sums := make(map[string]uint64, len(pairs))
+	for _, item := range pairs {
+		if next, ok := c.keyValue(item); ok {
+			kv = append(kv, next)
+			sums[next.Key] = codec.Hash(next.Value)
+		}
+	}
+
+	c.mu.Lock()
+	c.index = index
+	c.sums = sums
+	c.mu.Unlock()
+	return
+}
+
+// list lists the path by a blocking query waiting for a change after index.
+func (c *consul) list(ctx context.Context, index uint64) (api.KVPairs, uint64, error) {
+	q := (&api.QueryOptions{WaitIndex: index}).WithContext(ctx)
+	pairs, meta, err := c.client.KV().List(c.options.path, q)
+	if err != nil {
+		var status api.StatusError
+		if errors.As(err, &status) && (status.Code == http.StatusForbidden || status.Code == http.StatusUnauthorized) {
+			return nil, 0, fmt.Errorf("%w: %s: %s", ErrPermissionDenied, c.options.path, status.Body)
+		}
+		return nil, 0, err
+	}
+	if meta.LastIndex == 0 {
+		// an index is at least 1, or the next query never blocks
+		return pairs, 1, nil
+	}
+	return pairs, meta.LastIndex, nil
+}
+
+// changes returns the changed and deleted values of pairs listed at index,
+// the deleted keys are reported first.
+func (c *consul) changes(pairs api.KVPairs, index uint64) []*config.KeyValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < c.index {
+		// the index went backwards, such as a restored snapshot
+		index = 0
 	}
-	kv = make([]*config.KeyValue, 0)
-	for _, item := range kvs {
-		k := strings.TrimPrefix(item.Key, pathPrefix)
-		if k == "" {
+	c.index = index
+
+	var (
+		changed []*config.KeyValue
+		sums    = make(map[string]uint64, len(pairs))
+	)
+	for _, item := range pairs {
+		next, ok := c.keyValue(item)
+		if !ok {
+			continue
+		}
+		sum := codec.Hash(next.Value)
+		sums[next.Key] = sum
+		if old, ok := c.sums[next.Key]; ok && old == sum {
 			continue
 		}
-		kv = append(kv, &config.KeyValue{
-			Key:    k,
-			Value:  item.Value,
-			Format: strings.TrimPrefix(filepath.Ext(k), "."),
-		})
+		changed = append(changed, next)
 	}
-	return
+	deleted := make([]string, 0)
+	for k := range c.sums {
+		if _, ok := sums[k]; !ok {
+			deleted = append(deleted, k)
+		}
+	}
+	sort.Strings(deleted)
+	kvs := make([]*config.KeyValue, 0, len(deleted)+len(changed))
+	for _, k := range deleted {
+		kvs = append(kvs, &config.KeyValue{Key: k, Deleted: true})
+	}
+	kvs = append(kvs, changed...)
+	c.sums = sums
+	return kvs
+}
+
+func (c *consul) lastIndex() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.index
+}
+
+// keyValue returns the KeyValue of item relative to the path, in prefix mode
+// the key is a dotted path of the config tree, such as app/redis/addr => redis.addr.
+func (c *consul) keyValue(item *api.KVPair) (*config.KeyValue, bool) {
+	prefix := strings.TrimPrefix(c.options.path, "/")
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	k := strings.TrimPrefix(item.Key, prefix)
+	if k == "" || strings.HasSuffix(k, "/") {
+		// the path itself or a folder
+		return nil, false
+	}
+	if c.options.prefix {
+		return &config.KeyValue{Key: strings.ReplaceAll(k, "/", "."), Value: item.Value}, true
+	}
+	return &config.KeyValue{
+		Key:    k,
+		Value:  item.Value,
+		Format: strings.TrimPrefix(filepath.Ext(k), "."),
+	}, true
 }
 
 func (c *consul) Watch() (config.Watcher, error) {
@@ -0,0 +1,197 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/mcdull-kk/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsul is a stand-in of the Consul KV endpoint with blocking queries.
+type fakeConsul struct {
+	mu      sync.Mutex
+	index   uint64
+	kvs     map[string]*api.KVPair
+	changed chan struct{}
+	token   string
+}
+
+func newFakeConsul(t *testing.T) (*fakeConsul, string) {
+	f := &fakeConsul{index: 1, kvs: make(map[string]*api.KVPair), changed: make(chan struct{})}
+	s := httptest.NewServer(http.HandlerFunc(f.serveKV))
+	t.Cleanup(s.Close)
+	u, _ := url.Parse(s.URL)
+	return f, u.Host
+}
+
+func (f *fakeConsul) put(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.index++
+	f.kvs[key] = &api.KVPair{Key: key, Value: []byte(value), ModifyIndex: f.index}
+	f.notify()
+}
+
+func (f *fakeConsul) delete(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.index++
+	delete(f.kvs, key)
+	f.notify()
+}
+
+// touch bumps the index without changing the data.
+func (f *fakeConsul) touch() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.index++
+	f.notify()
+}
+
+func (f *fakeConsul) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) serveKV(w http.ResponseWriter, r *http.Request) {
+	prefix := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	wait, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+
+	f.mu.Lock()
+	if f.token != "" && r.Header.Get("X-Consul-Token") != f.token {
+		f.mu.Unlock()
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+	for wait > 0 && f.index <= wait {
+		changed := f.changed
+		f.mu.Unlock()
+		select {
+		case <-changed:
+		case <-time.After(100 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		f.mu.Lock()
+		if f.index <= wait {
+			break
+		}
+	}
+	defer f.mu.Unlock()
+	pairs := make(api.KVPairs, 0)
+	for k, kv := range f.kvs {
+		if strings.HasPrefix(k, prefix) {
+			pairs = append(pairs, kv)
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	if len(pairs) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(pairs)
+}
+
+func Test_consul(t *testing.T) {
+	f, addr := newFakeConsul(t)
+	f.put("app/app.json", `{"name":"app","port":8080}`)
+	f.put("app/db.json", `{"db":"mysql"}`)
+
+	c := config.New(config.WithSource(NewSource(WithAddr(addr), WithPath("app"))))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, "app", c.Value("name").StringOrDefault(""))
+	assert.Equal(t, "mysql", c.Value("db").StringOrDefault(""))
+
+	f.put("app/app.json", `{"name":"new","port":8080}`)
+	assert.Eventually(t, func() bool {
+		return c.Value("name").StringOrDefault("") == "new"
+	}, time.Second, 10*time.Millisecond)
+
+	f.delete("app/db.json")
+	assert.Eventually(t, func() bool {
+		_, err := c.Value("db").String()
+		return err == config.ErrNotFound
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_prefix(t *testing.T) {
+	f, addr := newFakeConsul(t)
+	f.put("app/", "")
+	f.put("app/redis/addr", "127.0.0.1:6379")
+	f.put("app/redis/db", "1")
+	f.put("app/name", "app")
+
+	c := config.New(config.WithSource(NewSource(WithAddr(addr), WithPath("app/"), WithPrefix(true))))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, "127.0.0.1:6379", c.Value("redis.addr").StringOrDefault(""))
+	assert.Equal(t, int64(1), c.Value("redis.db").IntOrDefault(0))
+	assert.Equal(t, "app", c.Value("name").StringOrDefault(""))
+
+	f.delete("app/redis/db")
+	assert.Eventually(t, func() bool {
+		_, err := c.Value("redis.db").String()
+		return err == config.ErrNotFound
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "127.0.0.1:6379", c.Value("redis.addr").StringOrDefault(""))
+}
+
+func Test_watchIndex(t *testing.T) {
+	f, addr := newFakeConsul(t)
+	f.put("app/name", "app")
+	s := NewSource(WithAddr(addr), WithPath("app"), WithPrefix(true))
+	_, err := s.Load()
+	assert.Nil(t, err)
+	w, err := s.Watch()
+	assert.Nil(t, err)
+	defer w.Stop()
+
+	// a new index with the identical data is not reported
+	f.touch()
+	f.put("app/name", "app")
+	f.put("app/port", "8080")
+	kvs, err := w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{{Key: "port", Value: []byte("8080")}}, kvs)
+
+	f.delete("app/name")
+	kvs, err = w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{{Key: "name", Deleted: true}}, kvs)
+}
+
+func Test_permissionDenied(t *testing.T) {
+	f, addr := newFakeConsul(t)
+	f.token = "secret"
+	f.put("app/name", "app")
+
+	_, err := NewSource(WithAddr(addr), WithPath("app"), WithToken("bad")).Load()
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+
+	s := NewSource(WithAddr(addr), WithPath("app"), WithToken("secret"))
+	_, err = s.Load()
+	assert.Nil(t, err)
+	w, err := s.Watch()
+	assert.Nil(t, err)
+	defer w.Stop()
+	f.mu.Lock()
+	f.token = "rotated"
+	f.mu.Unlock()
+	f.touch()
+	_, err = w.Next()
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+}
@@ -13,8 +13,9 @@ type (
 
 	options struct {
 		*api.Config
-		ctx  context.Context
-		path string
+		ctx    context.Context
+		path   string
+		prefix bool
 	}
 )
 
@@ -89,3 +90,11 @@ func WithPath(p string) Option {
 		o.path = p
 	}
 }
+
+// WithPrefix maps the keys under the path to a config tree,
+// such as app/redis/addr => redis.addr, all the values are leaves.
+func WithPrefix(prefix bool) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
@@ -3,70 +3,49 @@ package consul
 import (
 	"context"
 
-	"github.com/hashicorp/consul/api"
-	"github.com/hashicorp/consul/api/watch"
 	"github.com/mcdull-kk/pkg/config"
-	"github.com/mcdull-kk/pkg/rescue"
 )
 
 var _ config.Watcher = (*watcher)(nil)
 
 type watcher struct {
 	consul *consul
-	ch     chan interface{}
-	wp     *watch.Plan
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
 func newWatcher(c *consul) (*watcher, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	w := &watcher{
+	ctx, cancel := context.WithCancel(c.options.ctx)
+	return &watcher{
 		consul: c,
-		ch:     make(chan interface{}),
 		ctx:    ctx,
 		cancel: cancel,
-	}
-	wp, err := watch.Parse(map[string]interface{}{"type": "keyprefix", "prefix": c.options.path})
-	if err != nil {
-		return nil, err
-	}
-	wp.Handler = w.handle
-	w.wp = wp
-
-	rescue.GoSafe(func() {
-		err := wp.RunWithClientAndHclog(c.client, nil)
-		if err != nil {
-			panic(err)
-		}
-	})
-	return w, nil
-}
-
-func (w *watcher) handle(_ uint64, data interface{}) {
-	if data == nil {
-		return
-	}
-
-	_, ok := data.(api.KVPairs)
-	if !ok {
-		return
-	}
-
-	w.ch <- struct{}{}
+	}, nil
 }
 
+// Next blocks on the X-Consul-Index of the last list, and returns the
+// changed and deleted values. The identical data of a new index is skipped.
 func (w *watcher) Next() ([]*config.KeyValue, error) {
-	select {
-	case <-w.ch:
-		return w.consul.Load()
-	case <-w.ctx.Done():
-		return nil, w.ctx.Err()
+	for {
+		index := w.consul.lastIndex()
+		pairs, next, err := w.consul.list(w.ctx, index)
+		if err != nil {
+			if w.ctx.Err() != nil {
+				return nil, w.ctx.Err()
+			}
+			return nil, err
+		}
+		if next == index {
+			// the blocking query timed out
+			continue
+		}
+		if kvs := w.consul.changes(pairs, next); len(kvs) > 0 {
+			return kvs, nil
+		}
 	}
 }
 
 func (w *watcher) Stop() error {
-	w.wp.Stop()
 	w.cancel()
 	return nil
 }
@@ -0,0 +1,164 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mcdull-kk/pkg/codec"
+)
+
+type (
+	// DebugOption is the option of NewDebugHandler.
+	DebugOption func(*debugHandler)
+
+	debugHandler struct {
+		c    Config
+		keys map[string]struct{}
+	}
+
+	debugInfo struct {
+		Version   uint64            `json:"version"`
+		Config    map[string]any    `json:"config"`
+		Origins   map[string]string `json:"origins"`
+		Sources   []SourceStatus    `json:"sources"`
+		Observers []debugObserver   `json:"observers,omitempty"`
+		History   []debugChange     `json:"history,omitempty"`
+	}
+
+	debugObserver struct {
+		Kind string `json:"kind"`
+		Key  string `json:"key"`
+	}
+
+	debugChange struct {
+		Version uint64     `json:"version"`
+		Time    time.Time  `json:"time"`
+		Changes *ChangeSet `json:"changes"`
+	}
+
+	observerLister interface {
+		listObservers() []debugObserver
+	}
+)
+
+// DebugMaskKey masks the values of keys in the output besides secrets,
+// the last path segment is matched case-insensitively like log.FilterKey.
+func DebugMaskKey(keys ...string) DebugOption {
+	return func(h *debugHandler) {
+		for _, k := range keys {
+			h.keys[strings.ToLower(k)] = struct{}{}
+		}
+	}
+}
+
+// NewDebugHandler returns a http.Handler which shows the merged config,
+// the sources, the observers and the recent changes of c in json.
+func NewDebugHandler(c Config, opts ...DebugOption) http.Handler {
+	h := &debugHandler{c: c, keys: make(map[string]struct{})}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	snapshot := h.c.Snapshot()
+	info := &debugInfo{
+		Version: snapshot.Version,
+		Config:  h.mask("", snapshot.Values).(map[string]any),
+		Origins: make(map[string]string),
+		Sources: h.c.Sources(),
+	}
+	leaves := make(map[string]any)
+	flatten("", snapshot.Values, leaves)
+	for path := range leaves {
+		if origin, ok := h.c.Origin(path); ok {
+			info.Origins[path] = origin
+		}
+	}
+	if l, ok := h.c.(observerLister); ok {
+		info.Observers = l.listObservers()
+	}
+	history := h.c.History()
+	for i := len(history) - 1; i > 0; i-- {
+		cs, err := h.c.Diff(history[i-1].Version, history[i].Version)
+		if err != nil {
+			continue
+		}
+		info.History = append(info.History, debugChange{
+			Version: history[i].Version,
+			Time:    history[i].Time,
+			Changes: h.maskChanges(cs),
+		})
+	}
+	data, err := codec.GetCodec(codec.JsonName).Marshal(info)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (h *debugHandler) masked(path string) bool {
+	if idx := strings.LastIndex(path, "."); idx >= 0 {
+		path = path[idx+1:]
+	}
+	_, ok := h.keys[strings.ToLower(path)]
+	return ok
+}
+
+func (h *debugHandler) mask(path string, v any) any {
+	if path != "" && h.masked(path) {
+		return redacted
+	}
+	if m, ok := v.(map[string]any); ok {
+		masked := make(map[string]any, len(m))
+		for k, sub := range m {
+			masked[k] = h.mask(joinPath(path, k), sub)
+		}
+		return masked
+	}
+	return v
+}
+
+func (h *debugHandler) maskChanges(cs *ChangeSet) *ChangeSet {
+	mask := func(changes []Change) {
+		for i, c := range changes {
+			if c.Old != nil {
+				changes[i].Old = h.mask(c.Path, c.Old)
+			}
+			if c.New != nil {
+				changes[i].New = h.mask(c.Path, c.New)
+			}
+		}
+	}
+	mask(cs.Added)
+	mask(cs.Modified)
+	mask(cs.Deleted)
+	return cs
+}
+
+func (c *config) listObservers() []debugObserver {
+	subs := c.observers.snapshot()
+	list := make([]debugObserver, 0, len(subs))
+	for _, sub := range subs {
+		kind := "key"
+		if sub.change != nil {
+			kind = "prefix"
+		}
+		list = append(list, debugObserver{Kind: kind, Key: sub.key})
+	}
+	c.scanLock.Lock()
+	for _, s := range c.scanners {
+		list = append(list, debugObserver{Kind: "scan", Key: s.typ.String()})
+	}
+	c.scanLock.Unlock()
+	return list
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugHandler(t *testing.T) {
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull","redis":{"addr":"127.0.0.1:6379","password":"p1"}}`)})
+	c := New(WithSourceOptions(src, WithSourceName("app")))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	c.WatchPrefix("redis", func(string, *ChangeSet) {})
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"kk","redis":{"addr":"127.0.0.1:6379","password":"p2"}}`)})
+
+	h := NewDebugHandler(c, DebugMaskKey("Password"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "p1")
+	assert.NotContains(t, rec.Body.String(), "p2")
+
+	var info debugInfo
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, uint64(2), info.Version)
+	assert.Equal(t, map[string]any{"name": "kk", "redis": map[string]any{"addr": "127.0.0.1:6379", "password": redacted}}, info.Config)
+	assert.Equal(t, "app", info.Origins["redis.addr"])
+	assert.Len(t, info.Sources, 1)
+	assert.Equal(t, "app", info.Sources[0].Name)
+	assert.True(t, info.Sources[0].Loaded)
+	assert.Equal(t, []debugObserver{{Kind: "prefix", Key: "redis"}}, info.Observers)
+	assert.Len(t, info.History, 1)
+	assert.Equal(t, []Change{{Path: "name", Old: "mcdull", New: "kk"}, {Path: "redis.password", Old: redacted, New: redacted}}, info.History[0].Changes.Modified)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/config", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestConfig_Sources(t *testing.T) {
+	c := New(WithSourceOptions(failSource{}, WithSourceName("remote"), WithPriority(1)))
+	assert.NotNil(t, c.Load())
+	status := c.Sources()
+	assert.Len(t, status, 1)
+	assert.Equal(t, "remote", status[0].Name)
+	assert.Equal(t, 1, status[0].Priority)
+	assert.False(t, status[0].Loaded)
+	assert.Equal(t, "source is down", status[0].Error)
+}
@@ -0,0 +1,150 @@
+package env
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mcdull-kk/pkg/codec"
+	"github.com/mcdull-kk/pkg/config"
+	"github.com/mcdull-kk/pkg/log"
+)
+
+// maxExactInt is the max integer kept exactly by float64 in json.
+const maxExactInt = 1 << 53
+
+// ErrPrefixEmpty is returned by NewSource without a prefix,
+// which would load the whole process environment like PATH and HOME.
+var ErrPrefixEmpty = errors.New("env prefix is empty")
+
+var _ config.Source = (*env)(nil)
+
+type env struct {
+	opts *options
+}
+
+// NewSource returns a source of process environment variables,
+// the prefix of WithPrefix is required.
+func NewSource(opts ...Option) (config.Source, error) {
+	o := &options{
+		separator: "__",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.prefix == "" {
+		return nil, ErrPrefixEmpty
+	}
+	return &env{opts: o}, nil
+}
+
+func (e *env) Load() ([]*config.KeyValue, error) {
+	return e.load(os.Environ())
+}
+
+func (e *env) load(envs []string) ([]*config.KeyValue, error) {
+	vars := make(map[string]string)
+	for _, kv := range envs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(k, e.opts.prefix) {
+			continue
+		}
+		if key := e.key(strings.TrimPrefix(k, e.opts.prefix)); key != "" {
+			vars[key] = v
+		}
+	}
+
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	// shorter keys first, so a nested key overrides the scalar of its parent
+	sort.Strings(keys)
+	target := make(map[string]any)
+	for _, k := range keys {
+		set(target, k, convert(vars[k]))
+	}
+
+	data, err := codec.GetCodec(codec.JsonName).Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+	return []*config.KeyValue{{
+		Key:    "env",
+		Value:  data,
+		Format: codec.JsonName,
+	}}, nil
+}
+
+func (e *env) Watch() (config.Watcher, error) {
+	return config.NewStaticWatcher(), nil
+}
+
+func (e *env) Close() error {
+	return nil
+}
+
+// key converts REDIS__MAX_IDLE into redis.max_idle.
+func (e *env) key(name string) string {
+	parts := strings.Split(name, e.opts.separator)
+	for i, p := range parts {
+		if p == "" {
+			return ""
+		}
+		parts[i] = strings.ToLower(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// convert parses numbers, booleans and json objects or arrays if they are
+// formatted back into exactly v, so "007", "1e3" or too big integers are
+// kept as string like any other value.
+func convert(v string) any {
+	if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if strconv.FormatInt(i, 10) == v && i >= -maxExactInt && i <= maxExactInt {
+			return i
+		}
+		return v
+	}
+	if f, err := strconv.ParseFloat(v, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == v {
+		return f
+	}
+	switch v {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if strings.HasPrefix(v, "{") || strings.HasPrefix(v, "[") {
+		var js any
+		if err := json.Unmarshal([]byte(v), &js); err == nil {
+			return js
+		}
+	}
+	return v
+}
+
+// set puts value at the nested path of the dotted key, and warns
+// when a scalar of a parent key is replaced by the nested map.
+func set(target map[string]any, key string, value any) {
+	keys := strings.Split(key, ".")
+	last := len(keys) - 1
+	for i, k := range keys {
+		if i == last {
+			target[k] = value
+			return
+		}
+		next, ok := target[k].(map[string]any)
+		if !ok {
+			if _, exist := target[k]; exist {
+				log.Warnf("env key %s overrides the value of %s", key, strings.Join(keys[:i+1], "."))
+			}
+			next = make(map[string]any)
+			target[k] = next
+		}
+		target = next
+	}
+}
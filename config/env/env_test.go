@@ -0,0 +1,71 @@
+package env
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mcdull-kk/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_load(t *testing.T) {
+	src, err := NewSource(WithPrefix("APP_"))
+	assert.Nil(t, err)
+	s := src.(*env)
+	kvs, err := s.load([]string{
+		"APP_NAME=mcdull",
+		"APP_REDIS__ADDR=127.0.0.1:6379",
+		"APP_REDIS__MAX_IDLE=10",
+		"APP_REDIS__TLS=true",
+		"APP_RATE=0.5",
+		"APP_HOSTS=[\"a\",\"b\"]",
+		"APP_LABELS={\"zone\":\"sh\"}",
+		"APP_NAN=nan",
+		"APP_CODE=007",
+		"APP_ID=12345678901234567890",
+		"APP_BIG=9007199254740993",
+		"APP_EXP=1e3",
+		"APP_YES=TRUE",
+		"APP_BAD__=x",
+		"PATH=/usr/bin",
+	})
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 1)
+	assert.Equal(t, "json", kvs[0].Format)
+	assert.JSONEq(t, `{
+		"name": "mcdull",
+		"redis": {"addr": "127.0.0.1:6379", "max_idle": 10, "tls": true},
+		"rate": 0.5,
+		"hosts": ["a", "b"],
+		"labels": {"zone": "sh"},
+		"nan": "nan",
+		"code": "007",
+		"id": "12345678901234567890",
+		"big": "9007199254740993",
+		"exp": "1e3",
+		"yes": "TRUE"
+	}`, string(kvs[0].Value))
+}
+
+func Test_env(t *testing.T) {
+	t.Setenv("MCDULL_REDIS__ADDR", "redis:6379")
+	t.Setenv("MCDULL_REDIS__DB", "2")
+	t.Setenv("MCDULL_REDIS__URL", "redis://${redis.addr}/${redis.db:0}")
+
+	src, err := NewSource(WithPrefix("MCDULL_"))
+	assert.Nil(t, err)
+	c := config.New(config.WithSource(src))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	assert.Equal(t, "redis:6379", c.Value("redis.addr").StringOrDefault(""))
+	assert.Equal(t, int64(2), c.Value("redis.db").IntOrDefault(0))
+	assert.Equal(t, "redis://redis:6379/2", c.Value("redis.url").StringOrDefault(""))
+}
+
+func TestNewSource_PrefixEmpty(t *testing.T) {
+	_, err := NewSource()
+	assert.Equal(t, ErrPrefixEmpty, err)
+	_, err = NewSource(WithPrefix(""))
+	assert.Equal(t, ErrPrefixEmpty, err)
+}
@@ -0,0 +1,26 @@
+package env
+
+type (
+	Option func(*options)
+
+	options struct {
+		prefix    string
+		separator string
+	}
+)
+
+// WithPrefix only loads the variables with prefix, like "APP_",
+// the prefix is trimmed from keys.
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithSeparator sets the separator of key levels, default is "__",
+// so APP_REDIS__ADDR is loaded as redis.addr.
+func WithSeparator(sep string) Option {
+	return func(o *options) {
+		o.separator = sep
+	}
+}
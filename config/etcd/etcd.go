@@ -1,11 +1,14 @@
 package etcd
 
 import (
-	"context"
+	"errors"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/mcdull-kk/pkg/config"
+	"go.etcd.io/etcd/api/v3/mvccpb"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -13,29 +16,30 @@ type (
 	etcd struct {
 		client  *clientv3.Client
 		options *options
+
+		mu sync.Mutex
+		// revision is the last seen revision by Load and watchers
+		revision int64
+		// keys are the loaded keys, to find the deleted ones on re-list
+		keys map[string]struct{}
 	}
 )
 
-func NewSource(opts ...Option) (config.Source, *clientv3.Client) {
-	options := &options{
-		Config: clientv3.Config{},
-		ctx:    context.Background(),
-		path:   "",
-		prefix: false,
-	}
-	for _, opt := range opts {
-		opt(options)
-	}
+// ErrPathEmpty is returned by NewSource without a path.
+var ErrPathEmpty = errors.New("etcd path is empty")
 
+// NewSource returns an etcd config source, the client of WithClient
+// is shared and not closed by the source.
+func NewSource(opts ...Option) (config.Source, error) {
+	options := newOptions(opts)
 	if options.path == "" {
-		panic("etcd path invalid")
+		return nil, ErrPathEmpty
 	}
-
-	client, err := clientv3.New(options.Config)
+	client, err := options.newClient()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return &etcd{client: client, options: options}, client
+	return &etcd{client: client, options: options}, nil
 }
 
 func (e *etcd) Load() ([]*config.KeyValue, error) {
@@ -48,21 +52,97 @@ func (e *etcd) Load() ([]*config.KeyValue, error) {
 		return nil, err
 	}
 	kvs := make([]*config.KeyValue, 0, len(rsp.Kvs))
+	keys := make(map[string]struct{}, len(rsp.Kvs))
 	for _, item := range rsp.Kvs {
-		k := string(item.Key)
-		kvs = append(kvs, &config.KeyValue{
-			Key:    k,
-			Value:  item.Value,
-			Format: strings.TrimPrefix(filepath.Ext(k), "."),
-		})
+		kvs = append(kvs, keyValue(item))
+		keys[string(item.Key)] = struct{}{}
 	}
+
+	e.mu.Lock()
+	e.revision = rsp.Header.Revision
+	e.keys = keys
+	e.mu.Unlock()
 	return kvs, nil
 }
 
+// relist loads all the keys again, the keys gone since
+// the last Load are reported deleted before the loaded ones.
+func (e *etcd) relist() ([]*config.KeyValue, error) {
+	e.mu.Lock()
+	old := e.keys
+	e.mu.Unlock()
+
+	loaded, err := e.Load()
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	deleted := make([]string, 0)
+	for k := range old {
+		if _, ok := e.keys[k]; !ok {
+			deleted = append(deleted, k)
+		}
+	}
+	e.mu.Unlock()
+	sort.Strings(deleted)
+
+	kvs := make([]*config.KeyValue, 0, len(deleted)+len(loaded))
+	for _, k := range deleted {
+		kvs = append(kvs, &config.KeyValue{Key: k, Deleted: true})
+	}
+	return append(kvs, loaded...), nil
+}
+
+// apply returns the KeyValues of events newer than the last seen
+// revision, the events already seen by Load are skipped.
+func (e *etcd) apply(events []*clientv3.Event, revision int64) []*config.KeyValue {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	kvs := make([]*config.KeyValue, 0, len(events))
+	for _, ev := range events {
+		if ev.Kv.ModRevision <= e.revision {
+			continue
+		}
+		k := string(ev.Kv.Key)
+		if ev.Type == mvccpb.DELETE {
+			delete(e.keys, k)
+			kvs = append(kvs, &config.KeyValue{Key: k, Deleted: true})
+			continue
+		}
+		if e.keys == nil {
+			e.keys = make(map[string]struct{})
+		}
+		e.keys[k] = struct{}{}
+		kvs = append(kvs, keyValue(ev.Kv))
+	}
+	if revision > e.revision {
+		e.revision = revision
+	}
+	return kvs
+}
+
+func (e *etcd) lastRevision() int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.revision
+}
+
 func (e *etcd) Watch() (w config.Watcher, err error) {
 	return newWatcher(e), nil
 }
 
 func (e *etcd) Close() (err error) {
+	if e.options.client != nil {
+		return nil
+	}
 	return e.client.Close()
 }
+
+func keyValue(item *mvccpb.KeyValue) *config.KeyValue {
+	k := string(item.Key)
+	return &config.KeyValue{
+		Key:    k,
+		Value:  item.Value,
+		Format: strings.TrimPrefix(filepath.Ext(k), "."),
+	}
+}
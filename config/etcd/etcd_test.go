@@ -2,34 +2,68 @@ package etcd
 
 import (
 	"context"
+	"net/url"
 	"testing"
 	"time"
 
 	"github.com/mcdull-kk/pkg/codec"
 	"github.com/mcdull-kk/pkg/config"
 	"github.com/stretchr/testify/assert"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
 	"google.golang.org/grpc"
 )
 
+// newClient starts an embedded etcd server and returns a client of it.
+func newClient(t *testing.T) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	local, _ := url.Parse("http://127.0.0.1:0")
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{*local}, []url.URL{*local}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{*local}, []url.URL{*local}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd server is not ready")
+	}
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{e.Clients[0].Addr().String()},
+		DialTimeout: time.Second,
+	})
+	if !assert.Nil(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
 func Test_etcd(t *testing.T) {
 	path := "/mcdull-kk/test/config"
-	source, client := NewSource(
-		WithEndpoints([]string{"127.0.0.1:2379"}),
+	client := newClient(t)
+	source, err := NewSource(
+		WithEndpoints(client.Endpoints()),
 		WithDialTimeout(time.Second),
 		WithDialOptions([]grpc.DialOption{grpc.WithBlock()}),
 		WithPath(path),
 	)
+	assert.Nil(t, err)
 
-	// 保证先有值
-	// _, err := client.Put(context.Background(), path, "test config")
-	// assert.Nil(t, err)
+	_, err = client.Put(context.Background(), path, "test config")
+	assert.Nil(t, err)
 
 	c := config.New(
 		config.WithSource(
 			source,
 		),
 	)
-	defer c.Close()
+	defer c.Close(context.Background())
 
 	tests := []struct {
 		want string
@@ -42,19 +76,167 @@ func Test_etcd(t *testing.T) {
 		},
 	}
 
-	err := c.Load()
+	err = c.Load()
 	assert.Nil(t, err)
 
 	for _, tt := range tests {
 		t.Run(tt.want, func(t *testing.T) {
 			_, err = client.Put(context.Background(), path, tt.want)
-			time.Sleep(20 * time.Millisecond)
-			v := c.Value(path)
-			assert.Nil(t, v)
-			assert.Equal(t, tt.want, codec.Repr(v.Load()))
+			assert.Nil(t, err)
+			assert.Eventually(t, func() bool {
+				return codec.Repr(c.Value(path).Load()) == tt.want
+			}, time.Second, 10*time.Millisecond)
 		})
 	}
 
 	_, err = client.Delete(context.Background(), path)
 	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		return c.Value(path).Load() == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_prefix(t *testing.T) {
+	client := newClient(t)
+	source, err := NewSource(WithClient(client), WithPath("/app/"), WithPrefix(true))
+	assert.Nil(t, err)
+	ctx := context.Background()
+	_, err = client.Put(ctx, "/app/a.json", `{"name":"a","port":8080}`)
+	assert.Nil(t, err)
+	_, err = client.Put(ctx, "/app/b.json", `{"name":"b"}`)
+	assert.Nil(t, err)
+
+	c := config.New(config.WithSource(source))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, "b", c.Value("name").StringOrDefault(""))
+
+	_, err = client.Delete(ctx, "/app/b.json")
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		return c.Value("name").StringOrDefault("") == "a"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(8080), c.Value("port").IntOrDefault(0))
+}
+
+func Test_watchCompacted(t *testing.T) {
+	client := newClient(t)
+	source, err := NewSource(WithClient(client), WithPath("/app/"), WithPrefix(true))
+	assert.Nil(t, err)
+	defer source.Close()
+	ctx := context.Background()
+	_, err = client.Put(ctx, "/app/a", "1")
+	assert.Nil(t, err)
+	_, err = client.Put(ctx, "/app/b", "1")
+	assert.Nil(t, err)
+	kvs, err := source.Load()
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 2)
+
+	// the changes after Load are compacted before the watch resumes
+	_, err = client.Delete(ctx, "/app/a")
+	assert.Nil(t, err)
+	resp, err := client.Put(ctx, "/app/c", "1")
+	assert.Nil(t, err)
+	_, err = client.Compact(ctx, resp.Header.Revision)
+	assert.Nil(t, err)
+
+	w, err := source.Watch()
+	assert.Nil(t, err)
+	defer w.Stop()
+	kvs, err = w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{
+		{Key: "/app/a", Deleted: true},
+		{Key: "/app/b", Value: []byte("1")},
+		{Key: "/app/c", Value: []byte("1")},
+	}, kvs)
+
+	// the watch resumes after the re-listed revision
+	_, err = client.Put(ctx, "/app/b", "2")
+	assert.Nil(t, err)
+	kvs, err = w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{{Key: "/app/b", Value: []byte("2")}}, kvs)
+}
+
+func Test_watchResume(t *testing.T) {
+	client := newClient(t)
+	source, err := NewSource(WithClient(client), WithPath("/app/"), WithPrefix(true))
+	assert.Nil(t, err)
+	defer source.Close()
+	ctx := context.Background()
+	_, err = source.Load()
+	assert.Nil(t, err)
+	_, err = client.Put(ctx, "/app/a", "1")
+	assert.Nil(t, err)
+
+	// the watch resumes from the last Load
+	w, err := source.Watch()
+	assert.Nil(t, err)
+	defer w.Stop()
+	kvs, err := w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{{Key: "/app/a", Value: []byte("1")}}, kvs)
+
+	// the events seen by a later Load are not applied twice
+	_, err = client.Put(ctx, "/app/b", "1")
+	assert.Nil(t, err)
+	_, err = source.Load()
+	assert.Nil(t, err)
+	_, err = client.Delete(ctx, "/app/a")
+	assert.Nil(t, err)
+	kvs, err = w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{{Key: "/app/a", Deleted: true}}, kvs)
+}
+
+func Test_newSource(t *testing.T) {
+	_, err := NewSource(WithEndpoints([]string{"127.0.0.1:2379"}))
+	assert.Equal(t, ErrPathEmpty, err)
+	_, err = NewSource(WithPath("/app"))
+	assert.NotNil(t, err)
+}
+
+func Test_publisher(t *testing.T) {
+	client := newClient(t)
+	ctx := context.Background()
+	p, err := NewPublisher(WithClient(client))
+	assert.Nil(t, err)
+	defer p.Close()
+
+	rev, err := p.Publish(ctx, "/app/app.json", []byte(`{"name":"a"}`), 0)
+	assert.Nil(t, err)
+	_, err = p.Publish(ctx, "/app/app.json", []byte(`{"name":"b"}`), 0)
+	assert.Equal(t, ErrRevisionConflict, err)
+
+	// the publisher reading the old revision loses
+	value, got, err := p.Get(ctx, "/app/app.json")
+	assert.Nil(t, err)
+	assert.Equal(t, rev, got)
+	assert.Equal(t, `{"name":"a"}`, string(value))
+	next, err := p.Publish(ctx, "/app/app.json", []byte(`{"name":"b"}`), rev)
+	assert.Nil(t, err)
+	current, err := p.Publish(ctx, "/app/app.json", []byte(`{"name":"c"}`), rev)
+	assert.Equal(t, ErrRevisionConflict, err)
+	assert.Equal(t, next, current)
+
+	assert.Equal(t, ErrRevisionConflict, p.Delete(ctx, "/app/app.json", rev))
+	assert.Nil(t, p.Delete(ctx, "/app/app.json", next))
+	_, got, err = p.Get(ctx, "/app/app.json")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), got)
+
+	_, err = p.Publish(ctx, "/app/tmp.json", []byte(`{}`), 0, WithTTL(time.Minute))
+	assert.Nil(t, err)
+	rsp, err := client.Get(ctx, "/app/tmp.json")
+	assert.Nil(t, err)
+	assert.NotZero(t, rsp.Kvs[0].Lease)
+
+	// the lease of the conflicting publish is revoked
+	_, err = p.Publish(ctx, "/app/tmp.json", []byte(`{}`), 0, WithTTL(time.Minute))
+	assert.Equal(t, ErrRevisionConflict, err)
+	leases, err := client.Leases(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []clientv3.LeaseStatus{{ID: clientv3.LeaseID(rsp.Kvs[0].Lease)}}, leases.Leases)
 }
@@ -14,12 +14,40 @@ type (
 
 	options struct {
 		clientv3.Config
+		client *clientv3.Client
 		ctx    context.Context
 		path   string
 		prefix bool
 	}
 )
 
+func newOptions(opts []Option) *options {
+	o := &options{
+		Config: clientv3.Config{},
+		ctx:    context.Background(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// newClient returns the client of WithClient, or a new one by the Config.
+func (o *options) newClient() (*clientv3.Client, error) {
+	if o.client != nil {
+		return o.client, nil
+	}
+	return clientv3.New(o.Config)
+}
+
+// WithClient uses the client instead of creating one by the options,
+// the caller closes it.
+func WithClient(client *clientv3.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
 func WithEndpoints(endpoints []string) Option {
 	return func(o *options) {
 		o.Endpoints = endpoints
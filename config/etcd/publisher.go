@@ -0,0 +1,145 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mcdull-kk/pkg/log"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrRevisionConflict is returned if the key is modified since the given revision.
+var ErrRevisionConflict = errors.New("etcd config revision conflict")
+
+// revokeTimeout limits revoking the lease of a failed Publish,
+// which may fail for the canceled context.
+const revokeTimeout = 3 * time.Second
+
+type (
+	// Publisher writes config documents into etcd with compare-and-swap
+	// on the mod revision, so concurrent publishers never overwrite each other.
+	Publisher struct {
+		client *clientv3.Client
+		owned  bool
+	}
+
+	// PublishOption is the option of Publish.
+	PublishOption func(*publishOptions)
+
+	publishOptions struct {
+		ttl time.Duration
+	}
+)
+
+// WithTTL attaches the document to a lease of ttl,
+// the document is deleted once the lease expires.
+func WithTTL(ttl time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.ttl = ttl
+	}
+}
+
+// NewPublisher returns a Publisher by the client options, the path options are ignored.
+func NewPublisher(opts ...Option) (*Publisher, error) {
+	options := newOptions(opts)
+	client, err := options.newClient()
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{client: client, owned: options.client == nil}, nil
+}
+
+// Get returns the value and the mod revision of key,
+// the revision is 0 if the key does not exist.
+func (p *Publisher) Get(ctx context.Context, key string) ([]byte, int64, error) {
+	rsp, err := p.client.Get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(rsp.Kvs) == 0 {
+		return nil, 0, nil
+	}
+	return rsp.Kvs[0].Value, rsp.Kvs[0].ModRevision, nil
+}
+
+// Publish writes value into key if its mod revision is still revision,
+// a revision of 0 requires the key not to exist. It returns the new revision,
+// or the current revision with ErrRevisionConflict. The lease of WithTTL
+// is revoked if the value is not written.
+func (p *Publisher) Publish(ctx context.Context, key string, value []byte, revision int64, opts ...PublishOption) (int64, error) {
+	o := &publishOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	var (
+		putOpts []clientv3.OpOption
+		written bool
+	)
+	if o.ttl > 0 {
+		lease, err := p.client.Grant(ctx, int64((o.ttl+time.Second-1)/time.Second))
+		if err != nil {
+			return 0, err
+		}
+		putOpts = append(putOpts, clientv3.WithLease(lease.ID))
+		defer func() {
+			if !written {
+				p.revoke(lease.ID)
+			}
+		}()
+	}
+	rsp, err := p.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", revision)).
+		Then(clientv3.OpPut(key, string(value), putOpts...)).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !rsp.Succeeded {
+		return current(rsp), ErrRevisionConflict
+	}
+	written = true
+	return rsp.Header.Revision, nil
+}
+
+// Delete deletes key if its mod revision is still revision.
+func (p *Publisher) Delete(ctx context.Context, key string, revision int64) error {
+	rsp, err := p.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", revision)).
+		Then(clientv3.OpDelete(key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	if !rsp.Succeeded {
+		return ErrRevisionConflict
+	}
+	return nil
+}
+
+// Close closes the client created by NewPublisher.
+func (p *Publisher) Close() error {
+	if !p.owned {
+		return nil
+	}
+	return p.client.Close()
+}
+
+func (p *Publisher) revoke(id clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), revokeTimeout)
+	defer cancel()
+	if _, err := p.client.Revoke(ctx, id); err != nil {
+		log.Warnf("etcd failed to revoke lease %x: %v", id, err)
+	}
+}
+
+// current returns the mod revision read by the else branch of a failed txn.
+func current(rsp *clientv3.TxnResponse) int64 {
+	for _, r := range rsp.Responses {
+		if get := r.GetResponseRange(); get != nil && len(get.Kvs) > 0 {
+			return get.Kvs[0].ModRevision
+		}
+	}
+	return 0
+}
@@ -2,8 +2,11 @@ package etcd
 
 import (
 	"context"
+	"errors"
 
 	"github.com/mcdull-kk/pkg/config"
+	"github.com/mcdull-kk/pkg/log"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
@@ -15,34 +18,67 @@ type (
 		ch     clientv3.WatchChan
 		ctx    context.Context
 		cancel context.CancelFunc
+		// stop cancels the current watch channel
+		stop context.CancelFunc
 	}
 )
 
 func newWatcher(e *etcd) config.Watcher {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(e.options.ctx)
 	w := &watcher{
 		etcd:   e,
 		ctx:    ctx,
 		cancel: cancel,
 	}
+	w.watch()
+	return w
+}
 
-	var opts []clientv3.OpOption
-	if e.options.prefix {
+// watch resumes watching from the revision after the last seen one.
+func (w *watcher) watch() {
+	opts := []clientv3.OpOption{clientv3.WithProgressNotify()}
+	if w.etcd.options.prefix {
 		opts = append(opts, clientv3.WithPrefix())
 	}
-	w.ch = e.client.Watch(e.options.ctx, e.options.path, opts...)
-	return w
+	if rev := w.etcd.lastRevision(); rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	}
+	ctx, stop := context.WithCancel(w.ctx)
+	w.ch = w.etcd.client.Watch(clientv3.WithRequireLeader(ctx), w.etcd.options.path, opts...)
+	w.stop = stop
 }
 
+// Next returns the changes since the last seen revision, the deleted keys
+// are reported deleted. It re-lists all the keys if the revision is compacted.
 func (w *watcher) Next() ([]*config.KeyValue, error) {
-	select {
-	case resp := <-w.ch:
-		if resp.Err() != nil {
-			return nil, resp.Err()
+	for {
+		select {
+		case resp, ok := <-w.ch:
+			if err := w.ctx.Err(); err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, errors.New("etcd watch channel closed")
+			}
+			if resp.CompactRevision != 0 || errors.Is(resp.Err(), rpctypes.ErrCompacted) {
+				log.Warnf("etcd watch revision compacted at %d, re-list %s", resp.CompactRevision, w.etcd.options.path)
+				kvs, err := w.etcd.relist()
+				if err != nil {
+					return nil, err
+				}
+				w.stop()
+				w.watch()
+				return kvs, nil
+			}
+			if err := resp.Err(); err != nil {
+				return nil, err
+			}
+			if kvs := w.etcd.apply(resp.Events, resp.Header.Revision); len(kvs) > 0 {
+				return kvs, nil
+			}
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
 		}
-		return w.etcd.Load()
-	case <-w.ctx.Done():
-		return nil, w.ctx.Err()
 	}
 }
 
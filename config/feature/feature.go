@@ -0,0 +1,178 @@
+package feature
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/mcdull-kk/pkg/codec"
+	"github.com/mcdull-kk/pkg/config"
+	"github.com/mcdull-kk/pkg/log"
+)
+
+// buckets is the precision of percentage rollout, 0.01%.
+const buckets = 10000
+
+type (
+	// Flag is a feature flag defined in config, like:
+	//
+	//	features:
+	//	  new_checkout:
+	//	    enabled: true
+	//	    percentage: 20
+	//	    users: [u1, u2]
+	//	    tenants: [t1]
+	//	    start: 2024-01-01T00:00:00Z
+	//	    end: 2024-02-01T00:00:00Z
+	//
+	// A disabled flag or a flag out of its time window is off. Otherwise
+	// the allow-listed users and tenants are on, the others are bucketed
+	// by percentage if set, or on if there is no allow-list at all.
+	Flag struct {
+		Enabled    bool       `json:"enabled"`
+		Percentage *float64   `json:"percentage"`
+		Users      []string   `json:"users"`
+		Tenants    []string   `json:"tenants"`
+		Start      *time.Time `json:"start"`
+		End        *time.Time `json:"end"`
+
+		users   map[string]struct{}
+		tenants map[string]struct{}
+	}
+
+	// Target is who the flags are evaluated for.
+	Target struct {
+		UserID   string
+		TenantID string
+	}
+
+	// Flags evaluates the flags of the merged config, it is refreshed
+	// on config changes and safe for concurrent use.
+	Flags struct {
+		opts   *options
+		c      config.Config
+		flags  atomic.Value
+		cancel config.Cancel
+	}
+)
+
+// New loads the flags under prefix of c and keeps them refreshed,
+// an invalid update is logged and the last valid flags are kept.
+func New(c config.Config, opts ...Option) (*Flags, error) {
+	o := &options{
+		prefix: "features",
+		now:    time.Now,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	f := &Flags{opts: o, c: c}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	f.cancel = c.WatchPrefix(o.prefix, func(string, *config.ChangeSet) {
+		if err := f.load(); err != nil {
+			log.Errorf("failed to reload feature flags: %v", err)
+		}
+	})
+	return f, nil
+}
+
+// Enabled reports whether the flag name is on for t,
+// an undefined flag is off.
+func (f *Flags) Enabled(name string, t Target) bool {
+	flag, ok := f.flags.Load().(map[string]*Flag)[name]
+	if !ok {
+		return false
+	}
+	return flag.enabled(name, t, f.opts.now())
+}
+
+// Flag returns the definition of the flag name.
+func (f *Flags) Flag(name string) (Flag, bool) {
+	flag, ok := f.flags.Load().(map[string]*Flag)[name]
+	if !ok {
+		return Flag{}, false
+	}
+	return *flag, true
+}
+
+// Stop stops refreshing the flags.
+func (f *Flags) Stop() {
+	f.cancel()
+}
+
+func (f *Flags) load() error {
+	flags := make(map[string]*Flag)
+	v := f.c.Value(f.opts.prefix)
+	if v.Load() != nil {
+		if err := v.Scan(&flags); err != nil {
+			return fmt.Errorf("%s: %w", f.opts.prefix, err)
+		}
+	}
+	for name, flag := range flags {
+		if flag == nil {
+			return fmt.Errorf("%s.%s: flag is empty", f.opts.prefix, name)
+		}
+		if err := flag.init(); err != nil {
+			return fmt.Errorf("%s.%s: %w", f.opts.prefix, name, err)
+		}
+	}
+	f.flags.Store(flags)
+	return nil
+}
+
+func (flag *Flag) init() error {
+	if p := flag.Percentage; p != nil && (*p < 0 || *p > 100) {
+		return fmt.Errorf("percentage %v is out of range [0:100]", *p)
+	}
+	if flag.Start != nil && flag.End != nil && !flag.Start.Before(*flag.End) {
+		return fmt.Errorf("start %v is not before end %v", flag.Start, flag.End)
+	}
+	flag.users = toSet(flag.Users)
+	flag.tenants = toSet(flag.Tenants)
+	return nil
+}
+
+func (flag *Flag) enabled(name string, t Target, now time.Time) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if flag.Start != nil && now.Before(*flag.Start) {
+		return false
+	}
+	if flag.End != nil && !now.Before(*flag.End) {
+		return false
+	}
+	if _, ok := flag.users[t.UserID]; ok && t.UserID != "" {
+		return true
+	}
+	if _, ok := flag.tenants[t.TenantID]; ok && t.TenantID != "" {
+		return true
+	}
+	if flag.Percentage == nil {
+		return len(flag.users) == 0 && len(flag.tenants) == 0
+	}
+	id := t.UserID
+	if id == "" {
+		id = t.TenantID
+	}
+	if id == "" {
+		return *flag.Percentage >= 100
+	}
+	return bucket(name, id) < uint64(*flag.Percentage*buckets/100)
+}
+
+// bucket maps id into [0, buckets) by murmur hash, the flag
+// name is hashed along so flags are bucketed independently.
+func bucket(name, id string) uint64 {
+	return codec.Hash([]byte(name+"/"+id)) % buckets
+}
+
+func toSet(items []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		set[item] = struct{}{}
+	}
+	return set
+}
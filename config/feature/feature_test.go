@@ -0,0 +1,149 @@
+package feature
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mcdull-kk/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	testSource struct {
+		kvs []*config.KeyValue
+		ch  chan []*config.KeyValue
+	}
+
+	testWatcher struct {
+		ch   chan []*config.KeyValue
+		done chan struct{}
+	}
+)
+
+func newTestSource(data string) *testSource {
+	return &testSource{
+		kvs: []*config.KeyValue{{Key: "features.yaml", Format: "yaml", Value: []byte(data)}},
+		ch:  make(chan []*config.KeyValue),
+	}
+}
+
+func (s *testSource) Load() ([]*config.KeyValue, error) { return s.kvs, nil }
+func (s *testSource) Close() error                      { return nil }
+func (s *testSource) Watch() (config.Watcher, error) {
+	return &testWatcher{ch: s.ch, done: make(chan struct{})}, nil
+}
+
+// push delivers data to the watcher and waits until it is applied.
+func (s *testSource) push(data string) {
+	s.ch <- []*config.KeyValue{{Key: "features.yaml", Format: "yaml", Value: []byte(data)}}
+	s.ch <- nil
+}
+
+func (w *testWatcher) Next() ([]*config.KeyValue, error) {
+	for {
+		select {
+		case kvs := <-w.ch:
+			if kvs == nil {
+				continue
+			}
+			return kvs, nil
+		case <-w.done:
+			return nil, context.Canceled
+		}
+	}
+}
+
+func (w *testWatcher) Stop() error {
+	close(w.done)
+	return nil
+}
+
+const testFlags = `
+features:
+  checkout:
+    enabled: true
+    percentage: 30
+    users: [vip]
+  beta:
+    enabled: true
+    tenants: [t1]
+  sale:
+    enabled: true
+    start: 2024-01-01T00:00:00Z
+    end: 2024-02-01T00:00:00Z
+  off:
+    enabled: false
+    percentage: 100
+`
+
+func TestFlags(t *testing.T) {
+	now := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	src := newTestSource(testFlags)
+	c := config.New(config.WithSource(src))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	f, err := New(c, WithClock(func() time.Time { return now }))
+	assert.Nil(t, err)
+	defer f.Stop()
+
+	tests := []struct {
+		name   string
+		target Target
+		want   bool
+	}{
+		{name: "checkout", target: Target{UserID: "vip"}, want: true},
+		{name: "checkout", target: Target{}, want: false},
+		{name: "beta", target: Target{TenantID: "t1"}, want: true},
+		{name: "beta", target: Target{UserID: "u1", TenantID: "t2"}, want: false},
+		{name: "sale", target: Target{}, want: true},
+		{name: "off", target: Target{UserID: "vip"}, want: false},
+		{name: "undefined", target: Target{UserID: "vip"}, want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, f.Enabled(tt.name, tt.target), "%s %+v", tt.name, tt.target)
+	}
+
+	now = time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	assert.False(t, f.Enabled("sale", Target{}))
+
+	var on int
+	for i := 0; i < 10000; i++ {
+		target := Target{UserID: fmt.Sprintf("user-%d", i)}
+		enabled := f.Enabled("checkout", target)
+		assert.Equal(t, enabled, f.Enabled("checkout", target))
+		if enabled {
+			on++
+		}
+	}
+	assert.InDelta(t, 3000, on, 200)
+
+	flag, ok := f.Flag("checkout")
+	assert.True(t, ok)
+	assert.Equal(t, 30.0, *flag.Percentage)
+}
+
+func TestFlags_Refresh(t *testing.T) {
+	src := newTestSource(testFlags)
+	c := config.New(config.WithSource(src))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	f, err := New(c)
+	assert.Nil(t, err)
+	defer f.Stop()
+	assert.False(t, f.Enabled("beta", Target{TenantID: "t2"}))
+
+	src.push("features:\n  beta:\n    enabled: true\n")
+	assert.True(t, f.Enabled("beta", Target{TenantID: "t2"}))
+
+	// the invalid update is dropped
+	src.push("features:\n  beta:\n    enabled: true\n    percentage: 120\n")
+	assert.True(t, f.Enabled("beta", Target{TenantID: "t2"}))
+
+	invalid := config.New(config.WithSource(newTestSource("features:\n  beta:\n    percentage: -1\n")))
+	assert.Nil(t, invalid.Load())
+	defer invalid.Close(context.Background())
+	_, err = New(invalid)
+	assert.EqualError(t, err, "features.beta: percentage -1 is out of range [0:100]")
+}
@@ -0,0 +1,27 @@
+package feature
+
+import "time"
+
+type (
+	Option func(*options)
+
+	options struct {
+		prefix string
+		now    func() time.Time
+	}
+)
+
+// WithPrefix sets the config key holding the flag definitions,
+// default is "features".
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithClock sets the clock of time windows, default is time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
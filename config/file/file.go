@@ -1,25 +1,63 @@
 package file
 
 import (
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/mcdull-kk/pkg/codec"
 	"github.com/mcdull-kk/pkg/config"
 )
 
 var _ config.Source = (*file)(nil)
 
+// volumeData is the symlink of the current data
+// directory in a Kubernetes volume.
+const volumeData = "..data"
+
+const defaultDebounce = 50 * time.Millisecond
+
 type file struct {
 	path string
+	opts *options
+	// root is the directory which keys are relative to,
+	// it is the base directory of a glob pattern
+	root string
+	glob bool
 }
 
-func NewSource(path string) config.Source {
-	return &file{path: path}
+// NewSource returns a source of a file, a directory which is loaded
+// recursively or a glob pattern like conf.d/*.yaml. The files are
+// merged in the order of their keys, which are the paths relative
+// to the directory, and the values of a file in a subdirectory are
+// nested under the directory names. Hidden files and directories,
+// and the files without a registered codec are skipped.
+func NewSource(path string, opts ...Option) config.Source {
+	o := &options{debounce: defaultDebounce}
+	for _, opt := range opts {
+		opt(o)
+	}
+	f := &file{path: path, opts: o, root: path}
+	if strings.ContainsAny(path, "*?[") {
+		f.glob = true
+		f.root = globRoot(path)
+	}
+	return f
 }
 
 func (f *file) Load() (kvs []*config.KeyValue, err error) {
+	if f.opts.volume {
+		return f.loadDir(filepath.Join(f.path, volumeData))
+	}
+	if f.glob {
+		return f.loadGlob()
+	}
 	fi, err := os.Stat(f.path)
 	if err != nil {
 		return nil, err
@@ -27,7 +65,7 @@ func (f *file) Load() (kvs []*config.KeyValue, err error) {
 	if fi.IsDir() {
 		return f.loadDir(f.path)
 	}
-	kv, err := f.loadFile(f.path)
+	kv, err := f.loadFile(f.path, fi.Name())
 	if err != nil {
 		return nil, err
 	}
@@ -43,25 +81,78 @@ func (f *file) Close() (err error) {
 	return nil
 }
 
-func (f *file) loadDir(path string) (kvs []*config.KeyValue, err error) {
-	files, err := os.ReadDir(path)
+func (f *file) loadGlob() (kvs []*config.KeyValue, err error) {
+	paths, err := filepath.Glob(f.path)
 	if err != nil {
 		return nil, err
 	}
-	for _, file := range files {
-		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+	for _, path := range paths {
+		if !f.match(path) {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.IsDir() {
 			continue
 		}
-		kv, err := f.loadFile(filepath.Join(path, file.Name()))
+		kv, err := f.loadFile(path, f.key(path))
 		if err != nil {
 			return nil, err
 		}
 		kvs = append(kvs, kv)
 	}
+	sortKeyValues(kvs)
+	return
+}
+
+func (f *file) loadDir(path string) (kvs []*config.KeyValue, err error) {
+	// the directory may be a symlink like ..data
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == path {
+			return nil
+		}
+		if hidden(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !supported(d.Name()) {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// symlinked directories are not followed
+			if fi, err := os.Stat(p); err == nil && fi.IsDir() {
+				return nil
+			}
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		kv, err := f.loadFile(p, filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		kvs = append(kvs, kv)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortKeyValues(kvs)
 	return
 }
 
-func (f *file) loadFile(path string) (*config.KeyValue, error) {
+func (f *file) loadFile(path, key string) (*config.KeyValue, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -77,14 +168,97 @@ func (f *file) loadFile(path string) (*config.KeyValue, error) {
 		return nil, err
 	}
 
-	format := ""
-	if p := strings.Split(info.Name(), "."); len(p) > 1 {
-		format = p[len(p)-1]
+	kv := &config.KeyValue{
+		Key:    key,
+		Format: format(info.Name()),
+		Value:  data,
 	}
+	return namespace(kv)
+}
 
-	return &config.KeyValue{
-		Key:    info.Name(),
-		Format: format,
-		Value:  data,
-	}, nil
+// namespace nests the values of a file in a subdirectory under the
+// directory names, such as: a/b.d/c.json => map[a][b][d] = values of c.json.
+func namespace(kv *config.KeyValue) (*config.KeyValue, error) {
+	dir := path.Dir(kv.Key)
+	code := codec.GetCodec(kv.Format)
+	if dir == "." || code == nil {
+		return kv, nil
+	}
+	values := make(map[string]any)
+	if err := code.Unmarshal(kv.Value, &values); err != nil {
+		return nil, fmt.Errorf("%s: %w", kv.Key, err)
+	}
+	segs := strings.Split(strings.ReplaceAll(dir, "/", "."), ".")
+	for i := len(segs) - 1; i >= 0; i-- {
+		values = map[string]any{segs[i]: values}
+	}
+	data, err := code.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", kv.Key, err)
+	}
+	kv.Value = data
+	return kv, nil
+}
+
+// key returns the key of path loaded by a directory or a glob pattern.
+func (f *file) key(path string) string {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// match reports whether path under the directory or the glob
+// pattern is a file of the source.
+func (f *file) match(path string) bool {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	for _, seg := range strings.Split(rel, string(filepath.Separator)) {
+		if hidden(seg) {
+			return false
+		}
+	}
+	if !supported(path) {
+		return false
+	}
+	if f.glob {
+		ok, _ := filepath.Match(f.path, path)
+		return ok
+	}
+	return true
+}
+
+// globRoot returns the longest directory of pattern without meta characters.
+func globRoot(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for strings.ContainsAny(dir, "*?[") {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// format returns the extension of name.
+func format(name string) string {
+	if p := strings.Split(name, "."); len(p) > 1 {
+		return p[len(p)-1]
+	}
+	return ""
+}
+
+// supported reports whether the format of name has a registered codec.
+func supported(name string) bool {
+	return codec.GetCodec(format(filepath.Base(name))) != nil
+}
+
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+func sortKeyValues(kvs []*config.KeyValue) {
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].Key < kvs[j].Key
+	})
 }
@@ -1,6 +1,7 @@
 package file
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -123,3 +124,169 @@ func Test_watch(t *testing.T) {
 		assert.Equal(t, tp.want, string(kvs[0].Value))
 	}
 }
+
+// writeVolume simulates kubelet updating a ConfigMap volume: the files
+// are written into a new data directory, which is swapped in by renaming
+// the ..data symlink, then the old data directory is removed.
+func writeVolume(t *testing.T, path, version string, files map[string]string) {
+	dir := filepath.Join(path, "..2024_"+version)
+	assert.Nil(t, os.Mkdir(dir, 0o700))
+	for name, data := range files {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600))
+	}
+	old, _ := os.Readlink(filepath.Join(path, volumeData))
+	tmp := filepath.Join(path, "..data_tmp")
+	assert.Nil(t, os.Symlink(filepath.Base(dir), tmp))
+	assert.Nil(t, os.Rename(tmp, filepath.Join(path, volumeData)))
+	for name := range files {
+		_ = os.Symlink(filepath.Join(volumeData, name), filepath.Join(path, name))
+	}
+	if old != "" {
+		assert.Nil(t, os.RemoveAll(filepath.Join(path, old)))
+	}
+}
+
+func Test_volume(t *testing.T) {
+	path := t.TempDir()
+	writeVolume(t, path, "1", map[string]string{
+		"app.json":   `{"name":"mcdull","redis":{"db":1}}`,
+		"redis.json": `{"redis":{"db":2}}`,
+	})
+	c := config.New(config.WithSource(NewSource(path, WithVolume())))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, int64(2), c.Value("redis.db").IntOrDefault(0))
+
+	writeVolume(t, path, "2", map[string]string{
+		"app.json": `{"name":"kk","redis":{"db":1}}`,
+	})
+	assert.Eventually(t, func() bool {
+		return c.Value("name").StringOrDefault("") == "kk"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(1), c.Value("redis.db").IntOrDefault(0))
+}
+
+func Test_recursive(t *testing.T) {
+	path := t.TempDir()
+	files := map[string]string{
+		"b.json":        `{"name":"b","db":1}`,
+		"a/c.json":      `{"name":"a/c"}`,
+		"a.json":        `{"name":"a","db":2}`,
+		".hidden.json":  `{"name":"hidden"}`,
+		".git/x.json":   `{"name":"git"}`,
+		"conf.d/d.yaml": "name: d",
+		"conf.d/e.txt":  "e",
+		"README.md":     "# conf",
+	}
+	for name, data := range files {
+		file := filepath.Join(path, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(file), 0o700))
+		assert.Nil(t, os.WriteFile(file, []byte(data), 0o600))
+	}
+
+	tests := []struct {
+		path string
+		keys []string
+	}{
+		{path: path, keys: []string{"a.json", "a/c.json", "b.json", "conf.d/d.yaml"}},
+		{path: filepath.Join(path, "*.json"), keys: []string{"a.json", "b.json"}},
+		{path: filepath.Join(path, "*", "*.*"), keys: []string{"a/c.json", "conf.d/d.yaml"}},
+		{path: filepath.Join(path, "conf.d", "*.yaml"), keys: []string{"d.yaml"}},
+	}
+	for _, tt := range tests {
+		kvs, err := NewSource(tt.path).Load()
+		assert.Nil(t, err)
+		var keys []string
+		for _, kv := range kvs {
+			keys = append(keys, kv.Key)
+		}
+		assert.Equal(t, tt.keys, keys, tt.path)
+	}
+
+	// the values of a subdirectory are nested under its name
+	c := config.New(config.WithSource(NewSource(path)))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, "b", c.Value("name").StringOrDefault(""))
+	assert.Equal(t, "a/c", c.Value("a.name").StringOrDefault(""))
+	assert.Equal(t, "d", c.Value("conf.d.name").StringOrDefault(""))
+}
+
+func Test_watchGlob(t *testing.T) {
+	path := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(path, "b.json"), []byte(`{"name":"b"}`), 0o600))
+	c := config.New(config.WithSource(NewSource(filepath.Join(path, "*", "*.json"))))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	_, err := c.Value("app.name").String()
+	assert.Equal(t, config.ErrNotFound, err)
+
+	// the new subdirectory is watched, and the files are merged by name
+	assert.Nil(t, os.Mkdir(filepath.Join(path, "app"), 0o700))
+	assert.Nil(t, os.WriteFile(filepath.Join(path, "app", "b.json"), []byte(`{"name":"b"}`), 0o600))
+	assert.Eventually(t, func() bool {
+		return c.Value("app.name").StringOrDefault("") == "b"
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, os.WriteFile(filepath.Join(path, "app", "a.json"), []byte(`{"name":"a"}`), 0o600))
+	assert.Never(t, func() bool {
+		return c.Value("app.name").StringOrDefault("") != "b"
+	}, 200*time.Millisecond, 10*time.Millisecond)
+	assert.Nil(t, os.WriteFile(filepath.Join(path, "app", "c.json"), []byte(`{"name":"c"}`), 0o600))
+	assert.Eventually(t, func() bool {
+		return c.Value("app.name").StringOrDefault("") == "c"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_watchDelete(t *testing.T) {
+	path := t.TempDir()
+	file := filepath.Join(path, "app.json")
+	assert.Nil(t, os.WriteFile(filepath.Join(path, "base.json"), []byte(`{"port":8080}`), 0o600))
+	assert.Nil(t, os.WriteFile(file, []byte(`{"name":"app"}`), 0o600))
+	c := config.New(config.WithSource(NewSource(path)))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, "app", c.Value("name").StringOrDefault(""))
+
+	assert.Nil(t, os.Remove(file))
+	assert.Eventually(t, func() bool {
+		_, err := c.Value("name").String()
+		return err == config.ErrNotFound
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(8080), c.Value("port").IntOrDefault(0))
+
+	// a file deleted and recreated in file mode is still watched
+	file = filepath.Join(t.TempDir(), "app.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{"name":"app"}`), 0o600))
+	w, err := NewSource(file).Watch()
+	assert.Nil(t, err)
+	defer w.Stop()
+	assert.Nil(t, os.Remove(file))
+	kvs, err := w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{{Key: "app.json", Deleted: true}}, kvs)
+	assert.Nil(t, os.WriteFile(file, []byte(`{"name":"new"}`), 0o600))
+	kvs, err = w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"new"}`, string(kvs[0].Value))
+}
+
+func Test_watchDebounce(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{"name":"app"}`), 0o600))
+	w, err := NewSource(file, WithDebounce(100*time.Millisecond)).Watch()
+	assert.Nil(t, err)
+	defer w.Stop()
+
+	// touching or rewriting the same content is not a change
+	now := time.Now()
+	assert.Nil(t, os.Chtimes(file, now, now))
+	assert.Nil(t, os.Chmod(file, 0o644))
+	assert.Nil(t, os.WriteFile(file, []byte(`{"name":"app"}`), 0o600))
+	// the partial writes are merged into one change
+	assert.Nil(t, os.WriteFile(file, []byte(`{"name":`), 0o600))
+	assert.Nil(t, os.WriteFile(file, []byte(`{"name":"new"}`), 0o600))
+	kvs, err := w.Next()
+	assert.Nil(t, err)
+	assert.Len(t, kvs, 1)
+	assert.Equal(t, `{"name":"new"}`, string(kvs[0].Value))
+}
@@ -0,0 +1,29 @@
+package file
+
+import "time"
+
+type (
+	Option func(*options)
+
+	options struct {
+		volume   bool
+		debounce time.Duration
+	}
+)
+
+// WithDebounce sets how long the watcher waits for the file events to
+// settle before reloading, so a partial write is not loaded. Default is 50ms.
+func WithDebounce(d time.Duration) Option {
+	return func(o *options) {
+		o.debounce = d
+	}
+}
+
+// WithVolume treats the path as a Kubernetes ConfigMap or Secret volume,
+// the files are read from the ..data directory and reloaded as a whole
+// after kubelet swaps the ..data symlink.
+func WithVolume() Option {
+	return func(o *options) {
+		o.volume = true
+	}
+}
@@ -2,10 +2,15 @@ package file
 
 import (
 	"context"
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/mcdull-kk/pkg/codec"
 	"github.com/mcdull-kk/pkg/config"
 )
 
@@ -14,6 +19,10 @@ var _ config.Watcher = (*watcher)(nil)
 type watcher struct {
 	f  *file
 	fw *fsnotify.Watcher
+	// dir is true for a directory or a glob pattern
+	dir bool
+	// sums are the checksums of the loaded files by key
+	sums map[string]uint64
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -24,46 +33,257 @@ func newWatcher(f *file) (config.Watcher, error) {
 	if err != nil {
 		return nil, err
 	}
-	if err := fw.Add(f.path); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &watcher{f: f, fw: fw, ctx: ctx, cancel: cancel}
+	if err := w.init(); err != nil {
+		cancel()
+		fw.Close()
 		return nil, err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	return &watcher{f: f, fw: fw, ctx: ctx, cancel: cancel}, nil
+	return w, nil
 }
 
-func (w *watcher) Next() (kvs []*config.KeyValue, err error) {
-	select {
-	case <-w.ctx.Done():
-		err = w.ctx.Err()
-		return
-	case err = <-w.fw.Errors:
-		return
-	case event := <-w.fw.Events:
-		if event.Op == fsnotify.Rename {
-			if _, err := os.Stat(event.Name); err == nil || os.IsExist(err) {
-				if err := w.fw.Add(event.Name); err != nil {
-					return nil, err
-				}
-			}
+func (w *watcher) init() error {
+	switch {
+	case w.f.opts.volume:
+		if err := w.fw.Add(w.f.path); err != nil {
+			return err
 		}
+	case w.f.glob:
+		w.dir = true
+	default:
 		fi, err := os.Stat(w.f.path)
 		if err != nil {
+			return err
+		}
+		w.dir = fi.IsDir()
+		if !w.dir {
+			// the directory is watched, since a file replaced
+			// or deleted by editors is no longer watched
+			if err := w.fw.Add(filepath.Dir(w.f.path)); err != nil {
+				return err
+			}
+		}
+	}
+	if w.dir {
+		if err := w.addDirs(w.f.root); err != nil {
+			return err
+		}
+	}
+	_, err := w.reload()
+	return err
+}
+
+// addDirs watches dir and its subdirectories, hidden ones are skipped.
+func (w *watcher) addDirs(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != dir && hidden(d.Name()) {
+			return filepath.SkipDir
+		}
+		return w.fw.Add(p)
+	})
+}
+
+// Next returns the changed files once the events settle, the
+// deleted files are reported deleted and unchanged ones are skipped.
+func (w *watcher) Next() ([]*config.KeyValue, error) {
+	for {
+		events, err := w.wait()
+		if err != nil {
+			return nil, err
+		}
+		var kvs []*config.KeyValue
+		switch {
+		case w.f.opts.volume:
+			kvs, err = w.handleVolume(events)
+		case w.dir:
+			kvs, err = w.handleDir(events)
+		default:
+			kvs, err = w.handleFile(events)
+		}
+		if err != nil || len(kvs) > 0 {
+			return kvs, err
+		}
+	}
+}
+
+// wait collects the events until there is no more event in
+// the debounce duration, chmod events are ignored.
+func (w *watcher) wait() (map[string]fsnotify.Op, error) {
+	var (
+		events = make(map[string]fsnotify.Op)
+		timer  = time.NewTimer(time.Hour)
+	)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-w.ctx.Done():
+			return nil, w.ctx.Err()
+		case err := <-w.fw.Errors:
 			return nil, err
+		case event := <-w.fw.Events:
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			events[event.Name] |= event.Op
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(w.f.opts.debounce)
+		case <-timer.C:
+			return events, nil
+		}
+	}
+}
+
+func (w *watcher) handleFile(events map[string]fsnotify.Op) ([]*config.KeyValue, error) {
+	if _, ok := events[filepath.Clean(w.f.path)]; !ok {
+		return nil, nil
+	}
+	kv, err := w.load(w.f.path, filepath.Base(w.f.path))
+	if err != nil || kv == nil {
+		return nil, err
+	}
+	return []*config.KeyValue{kv}, nil
+}
+
+// handleDir watches the new subdirectories and reloads the changed files,
+// new files are loaded by a full reload to keep the merge order.
+func (w *watcher) handleDir(events map[string]fsnotify.Op) ([]*config.KeyValue, error) {
+	var (
+		kvs    []*config.KeyValue
+		reload bool
+	)
+	for _, path := range sortedPaths(events) {
+		if events[path]&fsnotify.Create != 0 {
+			if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+				if hidden(filepath.Base(path)) {
+					continue
+				}
+				if err := w.addDirs(path); err != nil {
+					return nil, err
+				}
+				// files may be created before the directory is watched
+				reload = true
+				continue
+			}
 		}
-		path := w.f.path
-		if fi.IsDir() {
-			path = filepath.Join(w.f.path, filepath.Base(event.Name))
+		if !w.f.match(path) {
+			continue
 		}
-		kv, err := w.f.loadFile(path)
+		key := w.f.key(path)
+		if _, ok := w.sums[key]; !ok {
+			if _, err := os.Stat(path); err == nil {
+				reload = true
+			}
+			continue
+		}
+		kv, err := w.load(path, key)
 		if err != nil {
 			return nil, err
 		}
-		kvs = append(kvs, kv)
-		return kvs, nil
+		if kv != nil {
+			kvs = append(kvs, kv)
+		}
+	}
+	if reload {
+		return w.reload()
+	}
+	return kvs, nil
+}
+
+// handleVolume reloads the whole volume after the ..data symlink swap.
+func (w *watcher) handleVolume(events map[string]fsnotify.Op) ([]*config.KeyValue, error) {
+	for path := range events {
+		if filepath.Base(path) == volumeData {
+			return w.reload()
+		}
+	}
+	return nil, nil
+}
+
+// load returns the changed file of key, or a deleted KeyValue if it is
+// removed. It returns nil if the file is not changed.
+func (w *watcher) load(path, key string) (*config.KeyValue, error) {
+	kv, err := w.f.loadFile(path, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, ok := w.sums[key]; !ok {
+			return nil, nil
+		}
+		delete(w.sums, key)
+		return &config.KeyValue{Key: key, Deleted: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sum := codec.Hash(kv.Value)
+	if old, ok := w.sums[key]; ok && old == sum {
+		return nil, nil
 	}
+	w.sums[key] = sum
+	return kv, nil
+}
+
+// reload loads all the files, the keys of the last reload are reported
+// deleted first, so the removed files are dropped and the rest are
+// merged in the order of the files. It returns nil if nothing changed.
+func (w *watcher) reload() ([]*config.KeyValue, error) {
+	loaded, err := w.f.Load()
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]uint64, len(loaded))
+	for _, kv := range loaded {
+		sums[kv.Key] = codec.Hash(kv.Value)
+	}
+	if sameSums(sums, w.sums) {
+		return nil, nil
+	}
+	deleted := make([]string, 0, len(w.sums))
+	for key := range w.sums {
+		deleted = append(deleted, key)
+	}
+	sort.Strings(deleted)
+	kvs := make([]*config.KeyValue, 0, len(deleted)+len(loaded))
+	for _, key := range deleted {
+		kvs = append(kvs, &config.KeyValue{Key: key, Deleted: true})
+	}
+	w.sums = sums
+	return append(kvs, loaded...), nil
 }
 
 func (w *watcher) Stop() error {
 	w.cancel()
 	return w.fw.Close()
 }
+
+func sameSums(a, b map[string]uint64) bool {
+	if len(a) != len(b) || a == nil || b == nil {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedPaths(events map[string]fsnotify.Op) []string {
+	paths := make([]string, 0, len(events))
+	for path := range events {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
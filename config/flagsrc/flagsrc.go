@@ -0,0 +1,218 @@
+// Package flagsrc is the config source of command-line flags, it is
+// named flagsrc rather than flag to not shadow the standard flag package
+// imported alongside it.
+package flagsrc
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mcdull-kk/pkg/codec"
+	"github.com/mcdull-kk/pkg/config"
+)
+
+var (
+	_ config.Source = (*flags)(nil)
+	_ flag.Getter   = (*Slice)(nil)
+)
+
+type (
+	flags struct {
+		fs   *flag.FlagSet
+		args []string
+
+		once sync.Once
+		err  error
+		// overrides are --a.b.c=value args which are not defined in fs.
+		overrides map[string][]string
+	}
+
+	// Slice is a flag.Value collecting repeated flags as a list.
+	Slice []string
+)
+
+// NewSource returns a source of command-line flags. Flags defined in fs
+// are loaded by their dotted name with typed values if they are set,
+// undefined flags like --a.b.c=value override the config key a.b.c.
+func NewSource(fs *flag.FlagSet, args []string) config.Source {
+	f := &flags{
+		fs:        fs,
+		args:      args,
+		overrides: make(map[string][]string),
+	}
+	usage := fs.Usage
+	fs.Usage = func() {
+		if usage != nil {
+			usage()
+		} else {
+			fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+			fs.PrintDefaults()
+		}
+		f.printKeys()
+	}
+	return f
+}
+
+func (f *flags) Load() ([]*config.KeyValue, error) {
+	f.once.Do(func() {
+		f.err = f.parse()
+	})
+	if f.err != nil {
+		return nil, f.err
+	}
+	data, err := codec.GetCodec(codec.JsonName).Marshal(f.values())
+	if err != nil {
+		return nil, err
+	}
+	return []*config.KeyValue{{
+		Key:    "flag",
+		Value:  data,
+		Format: codec.JsonName,
+	}}, nil
+}
+
+func (f *flags) Watch() (config.Watcher, error) {
+	return config.NewStaticWatcher(), nil
+}
+
+func (f *flags) Close() error {
+	return nil
+}
+
+// parse picks the undefined dotted flags out and passes the rest to fs.
+func (f *flags) parse() error {
+	var defined []string
+	for i := 0; i < len(f.args); i++ {
+		arg := f.args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' { //nolint:gomnd
+			defined = append(defined, f.args[i:]...)
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		name, value, hasValue := strings.Cut(name, "=")
+		if fl := f.fs.Lookup(name); fl != nil || !strings.Contains(name, ".") {
+			defined = append(defined, arg)
+			// the value of non-boolean flag may be the next arg
+			if fl != nil && !hasValue && !isBoolFlag(fl) && i+1 < len(f.args) {
+				i++
+				defined = append(defined, f.args[i])
+			}
+			continue
+		}
+		if !hasValue {
+			value = "true"
+			if i+1 < len(f.args) && isValue(f.args[i+1]) {
+				i++
+				value = f.args[i]
+			}
+		}
+		f.overrides[name] = append(f.overrides[name], value)
+	}
+	if f.fs.Parsed() {
+		return nil
+	}
+	return f.fs.Parse(defined)
+}
+
+// isValue reports whether arg is a value rather than a flag,
+// a negative number like -1 is a value.
+func isValue(arg string) bool {
+	if !strings.HasPrefix(arg, "-") {
+		return true
+	}
+	_, err := strconv.ParseFloat(arg, 64)
+	return err == nil
+}
+
+func isBoolFlag(fl *flag.Flag) bool {
+	b, ok := fl.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// values expands the flags set and overrides into a nested map.
+func (f *flags) values() map[string]any {
+	target := make(map[string]any)
+	for _, kv := range f.keys() {
+		set(target, kv.key, kv.value)
+	}
+	return target
+}
+
+type keyValue struct {
+	key   string
+	value any
+}
+
+// keys returns the effective flag-derived keys sorted by key.
+func (f *flags) keys() []keyValue {
+	var kvs []keyValue
+	f.fs.Visit(func(fl *flag.Flag) {
+		var value any = fl.Value.String()
+		if g, ok := fl.Value.(flag.Getter); ok {
+			value = g.Get()
+		}
+		kvs = append(kvs, keyValue{key: fl.Name, value: value})
+	})
+	for name, values := range f.overrides {
+		if len(values) == 1 {
+			kvs = append(kvs, keyValue{key: name, value: values[0]})
+			continue
+		}
+		kvs = append(kvs, keyValue{key: name, value: values})
+	}
+	sort.Slice(kvs, func(i, j int) bool {
+		return kvs[i].key < kvs[j].key
+	})
+	return kvs
+}
+
+func (f *flags) printKeys() {
+	kvs := f.keys()
+	if len(kvs) == 0 {
+		return
+	}
+	fmt.Fprintln(f.fs.Output(), "Effective config keys from flags:")
+	for _, kv := range kvs {
+		fmt.Fprintf(f.fs.Output(), "  %s=%v\n", kv.key, kv.value)
+	}
+}
+
+// set puts the flag value at the nested path of its dotted name,
+// flags are sorted by name so a nested flag wins over its parent.
+func set(target map[string]any, key string, value any) {
+	keys := strings.Split(key, ".")
+	last := len(keys) - 1
+	for i, k := range keys {
+		if i == last {
+			target[k] = value
+			return
+		}
+		next, ok := target[k].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			target[k] = next
+		}
+		target = next
+	}
+}
+
+func (s *Slice) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+// Set appends value, so the flag can be repeated.
+func (s *Slice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (s *Slice) Get() any {
+	return []string(*s)
+}
@@ -0,0 +1,67 @@
+package flagsrc
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"testing"
+
+	"github.com/mcdull-kk/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_flag(t *testing.T) {
+	var hosts Slice
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("redis.port", 6379, "redis port")
+	fs.Bool("debug", false, "debug mode")
+	fs.String("name", "mcdull", "app name")
+	fs.Var(&hosts, "hosts", "hosts, can be repeated")
+
+	c := config.New(config.WithSource(NewSource(fs, []string{
+		"-redis.port", "6380",
+		"--hosts=a", "--hosts", "b",
+		"--app.name=mcdull-kk",
+		"--app.tags=x", "--app.tags", "y",
+		"--app.enable",
+		"--app.offset", "-1",
+		"--app.rate", "-0.5",
+		"-debug",
+		"positional",
+	})))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	assert.Equal(t, int64(6380), c.Value("redis.port").IntOrDefault(0))
+	assert.True(t, c.Value("debug").BoolOrDefault(false))
+	assert.Equal(t, "mcdull-kk", c.Value("app.name").StringOrDefault(""))
+	assert.True(t, c.Value("app.enable").BoolOrDefault(false))
+	assert.Equal(t, int64(-1), c.Value("app.offset").IntOrDefault(0))
+	assert.Equal(t, -0.5, c.Value("app.rate").FloatOrDefault(0))
+	// unset flag does not override other sources with its default value
+	assert.Nil(t, c.Value("name").Load())
+	assert.Equal(t, []string{"positional"}, fs.Args())
+
+	var v struct {
+		Hosts []string `json:"hosts"`
+		App   struct {
+			Tags []string `json:"tags"`
+		} `json:"app"`
+	}
+	assert.Nil(t, c.Scan(&v))
+	assert.Equal(t, []string{"a", "b"}, v.Hosts)
+	assert.Equal(t, []string{"x", "y"}, v.App.Tags)
+}
+
+func Test_usage(t *testing.T) {
+	var buf bytes.Buffer
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(&buf)
+	fs.Int("redis.port", 6379, "redis port")
+
+	_, err := NewSource(fs, []string{"--app.name=mcdull", "-redis.port=6380", "-h"}).Load()
+	assert.Equal(t, flag.ErrHelp, err)
+	assert.Contains(t, buf.String(), "redis port")
+	assert.Contains(t, buf.String(), "  app.name=mcdull\n")
+	assert.Contains(t, buf.String(), "  redis.port=6380\n")
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mcdull-kk/pkg/codec"
+	"github.com/mcdull-kk/pkg/log"
+)
+
+const (
+	defaultHistory = 10
+	// snapshotLayer is the layer name of the last-known-good snapshot,
+	// it has the lowest priority so any loaded source overrides it.
+	snapshotLayer = "snapshot"
+)
+
+// ErrVersionNotFound is the version not kept in history.
+var ErrVersionNotFound = errors.New("config version not found")
+
+type (
+	// Snapshot is a version of the merged config, secrets are redacted.
+	Snapshot struct {
+		Version uint64
+		Time    time.Time
+		Values  map[string]any
+	}
+
+	// revision is a committed version of the merged config with the
+	// layers it was merged from, raw is values before placeholders resolving.
+	revision struct {
+		version uint64
+		time    time.Time
+		values  map[string]any
+		raw     map[string]any
+		origins map[string]string
+		secrets map[string]struct{}
+		layers  map[string]*layer
+	}
+)
+
+func (rev *revision) snapshot() *Snapshot {
+	return &Snapshot{
+		Version: rev.version,
+		Time:    rev.time,
+		Values:  copyValue(redact(rev.values, rev.secrets)).(map[string]any),
+	}
+}
+
+// diffRevision compares two revisions, the changes of secret
+// paths are reported with redacted values.
+func diffRevision(from, to *revision) *ChangeSet {
+	cs := diff(from.values, to.values)
+	mask := func(changes []Change) {
+		for i, c := range changes {
+			_, s1 := from.secrets[c.Path]
+			_, s2 := to.secrets[c.Path]
+			if !s1 && !s2 {
+				continue
+			}
+			if c.Old != nil {
+				changes[i].Old = redacted
+			}
+			if c.New != nil {
+				changes[i].New = redacted
+			}
+		}
+	}
+	mask(cs.Added)
+	mask(cs.Modified)
+	mask(cs.Deleted)
+	return cs
+}
+
+// cloneLayers copies layers, the decoded kvs are never modified
+// in place so they are shared.
+func cloneLayers(layers map[string]*layer) map[string]*layer {
+	clone := make(map[string]*layer, len(layers))
+	for name, l := range layers {
+		kvs := make(map[string]map[string]any, len(l.kvs))
+		for k, v := range l.kvs {
+			kvs[k] = v
+		}
+		secrets := make(map[string]struct{}, len(l.secrets))
+		for k := range l.secrets {
+			secrets[k] = struct{}{}
+		}
+		clone[name] = &layer{
+			src:     l.src,
+			keys:    append([]string(nil), l.keys...),
+			kvs:     kvs,
+			secrets: secrets,
+		}
+	}
+	return clone
+}
+
+// saveSnapshot writes values into file atomically, the values still
+// hold the placeholders, escapes and ENC(...) as they are merged,
+// and the values of secret KeyValues are left out.
+func saveSnapshot(file string, values map[string]any) error {
+	data, err := codec.GetCodec(codec.JsonName).Marshal(values)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// loadSnapshot reads the last-known-good snapshot written by saveSnapshot.
+func loadSnapshot(file string) (*KeyValue, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	log.Warnf("config falls back to snapshot: %s", file)
+	return &KeyValue{Key: file, Value: data, Format: codec.JsonName}, nil
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failSource struct{}
+
+func (failSource) Load() ([]*KeyValue, error) { return nil, errors.New("source is down") }
+func (failSource) Watch() (Watcher, error)    { return nil, errors.New("source is down") }
+func (failSource) Close() error               { return nil }
+
+func TestConfig_Rollback(t *testing.T) {
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull","port":8080,"password":"${secret:file:` + writeSecret(t, "v1") + `}"}`)})
+	c := New(WithSource(src), WithHistory(3))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, uint64(1), c.Snapshot().Version)
+	assert.Equal(t, redacted, c.Snapshot().Values["password"])
+
+	var changes []*ChangeSet
+	c.WatchPrefix("", func(prefix string, cs *ChangeSet) {
+		changes = append(changes, cs)
+	})
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"bad","password":"${secret:file:` + writeSecret(t, "v2") + `}"}`)})
+	assert.Equal(t, uint64(2), c.Snapshot().Version)
+
+	cs, err := c.Diff(1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []Change{{Path: "name", Old: "mcdull", New: "bad"}, {Path: "password", Old: redacted, New: redacted}}, cs.Modified)
+	assert.Equal(t, []Change{{Path: "port", Old: float64(8080)}}, cs.Deleted)
+
+	assert.Nil(t, c.Rollback(1))
+	assert.Equal(t, uint64(3), c.Snapshot().Version)
+	assert.Equal(t, "mcdull", c.Value("name").StringOrDefault(""))
+	assert.Equal(t, "v1", c.Value("password").StringOrDefault(""))
+	assert.Len(t, changes, 2)
+	assert.Equal(t, []Change{{Path: "port", New: float64(8080)}}, changes[1].Added)
+
+	// later updates are merged on top of the rolled back layers
+	src.push(&KeyValue{Key: "other.json", Format: "json", Value: []byte(`{"debug":true}`)})
+	assert.Equal(t, "mcdull", c.Value("name").StringOrDefault(""))
+	assert.True(t, c.Value("debug").BoolOrDefault(false))
+
+	history := c.History()
+	assert.Len(t, history, 3)
+	assert.Equal(t, uint64(2), history[0].Version)
+	_, err = c.Diff(1, 4)
+	assert.True(t, errors.Is(err, ErrVersionNotFound))
+	assert.True(t, errors.Is(c.Rollback(1), ErrVersionNotFound))
+}
+
+func TestConfig_SnapshotFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	secret := writeSecret(t, "pass")
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull","password":"${secret:file:` + secret + `}"}`)})
+	c := New(WithSource(src), WithSnapshotFile(file))
+	assert.Nil(t, c.Load())
+	c.Close(context.Background())
+	data, err := os.ReadFile(file)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), `"pass"`)
+
+	assert.NotNil(t, New(WithSource(failSource{})).Load())
+
+	local := newTestSource(&KeyValue{Key: "local.json", Format: "json", Value: []byte(`{"port":8080}`)})
+	c = New(WithSource(failSource{}, local), WithSnapshotFile(file))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, "mcdull", c.Value("name").StringOrDefault(""))
+	assert.Equal(t, "pass", c.Value("password").StringOrDefault(""))
+	assert.Equal(t, int64(8080), c.Value("port").IntOrDefault(0))
+	origin, _ := c.Origin("name")
+	assert.Equal(t, snapshotLayer, origin)
+}
+
+// recoverSource fails to load and watch once, then recovers on reconnect,
+// its watcher breaks at once so that it keeps reconnecting.
+type recoverSource struct {
+	*testSource
+	loads, watches int32
+}
+
+type brokenWatcher struct{}
+
+func (brokenWatcher) Next() ([]*KeyValue, error) { return nil, errors.New("watcher is broken") }
+func (brokenWatcher) Stop() error                { return nil }
+
+func (s *recoverSource) Load() ([]*KeyValue, error) {
+	if atomic.AddInt32(&s.loads, 1) == 1 {
+		return nil, errors.New("source is down")
+	}
+	return s.testSource.Load()
+}
+
+func (s *recoverSource) Watch() (Watcher, error) {
+	if atomic.AddInt32(&s.watches, 1) == 1 {
+		return nil, errors.New("source is down")
+	}
+	return brokenWatcher{}, nil
+}
+
+func TestConfig_SnapshotEscape(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"a":"x","tpl":"$${a}","ref":"${a}"}`)})
+	c := New(WithSource(src), WithSnapshotFile(file))
+	assert.Nil(t, c.Load())
+	assert.Equal(t, "${a}", c.Value("tpl").StringOrDefault(""))
+	c.Close(context.Background())
+
+	c = New(WithSource(failSource{}), WithSnapshotFile(file))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, "${a}", c.Value("tpl").StringOrDefault(""))
+	assert.Equal(t, "x", c.Value("ref").StringOrDefault(""))
+}
+
+// slowFailSource fails to load after a while, so the other sources
+// reconnect while the config is still loading.
+type slowFailSource struct {
+	failSource
+}
+
+func (s slowFailSource) Load() ([]*KeyValue, error) {
+	time.Sleep(time.Millisecond)
+	return s.failSource.Load()
+}
+
+func TestConfig_FallbackRecover(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "snapshot.json")
+	c := New(WithSource(newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"snapshot"}`)})), WithSnapshotFile(file))
+	assert.Nil(t, c.Load())
+	c.Close(context.Background())
+
+	// the source reconnects in background while the others are
+	// still loaded from the snapshot, run with -race
+	src := &recoverSource{testSource: newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"remote"}`)})}
+	sources := []Option{WithSourceOptions(src, WithSourceName("remote")), WithSnapshotFile(file), WithWatchBackoff(time.Microsecond, time.Microsecond)}
+	for i := 0; i < 20; i++ {
+		sources = append(sources, WithSourceOptions(slowFailSource{}, WithSourceName(fmt.Sprintf("down%d", i))))
+	}
+	c = New(sources...)
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Eventually(t, func() bool {
+		return c.Value("name").StringOrDefault("") == "remote"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func writeSecret(t *testing.T, secret string) string {
+	file := filepath.Join(t.TempDir(), "secret")
+	assert.Nil(t, os.WriteFile(file, []byte(secret), 0o600))
+	return file
+}
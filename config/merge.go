@@ -0,0 +1,129 @@
+package config
+
+import (
+	"reflect"
+)
+
+// MergeStrategy defines how a source is merged into the config
+// merged from the sources before it.
+type MergeStrategy int
+
+const (
+	// MergeOverride replaces existing values, nested maps are merged.
+	MergeOverride MergeStrategy = iota
+	// MergeKeepExisting only adds the values which do not exist yet.
+	MergeKeepExisting
+	// MergeAppendSlices is MergeOverride but appends arrays.
+	MergeAppendSlices
+	// MergeSlicesByKey is MergeOverride but merges array items of object
+	// which have the same merge key, see WithMergeKey.
+	MergeSlicesByKey
+)
+
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeOverride:
+		return "override"
+	case MergeKeepExisting:
+		return "keep-existing"
+	case MergeAppendSlices:
+		return "append-slices"
+	case MergeSlicesByKey:
+		return "slices-by-key"
+	default:
+		return ""
+	}
+}
+
+// merge merges src into dst by the source options, the leaf paths
+// written by src are recorded into origins with the source name.
+func merge(path string, dst, src map[string]any, s *source, origins map[string]string) {
+	for k, sv := range src {
+		key := joinPath(path, k)
+		dv, ok := dst[k]
+		if !ok {
+			dst[k] = sv
+			markOrigin(key, sv, s.name, origins)
+			continue
+		}
+		dm, dIsMap := dv.(map[string]any)
+		sm, sIsMap := sv.(map[string]any)
+		if dIsMap && sIsMap {
+			merge(key, dm, sm, s, origins)
+			continue
+		}
+		if s.strategy == MergeKeepExisting {
+			continue
+		}
+		ds, dIsSlice := dv.([]any)
+		ss, sIsSlice := sv.([]any)
+		if dIsSlice && sIsSlice {
+			switch s.strategy {
+			case MergeAppendSlices:
+				sv = append(append(make([]any, 0, len(ds)+len(ss)), ds...), ss...)
+			case MergeSlicesByKey:
+				sv = mergeSliceByKey(ds, ss, s.mergeKey)
+			}
+		}
+		dst[k] = sv
+		markOrigin(key, sv, s.name, origins)
+	}
+}
+
+// mergeSliceByKey merges object items of src into the dst item which
+// has the same value of key, other items of src are appended.
+func mergeSliceByKey(dst, src []any, key string) []any {
+	merged := append(make([]any, 0, len(dst)+len(src)), dst...)
+	for _, item := range src {
+		sm, ok := item.(map[string]any)
+		if !ok || sm[key] == nil {
+			merged = append(merged, item)
+			continue
+		}
+		found := false
+		for i, exist := range merged {
+			dm, ok := exist.(map[string]any)
+			if ok && reflect.DeepEqual(dm[key], sm[key]) {
+				next := copyValue(dm).(map[string]any)
+				merge("", next, sm, &source{sourceOptions: sourceOptions{strategy: MergeSlicesByKey, mergeKey: key}}, map[string]string{})
+				merged[i] = next
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+func markOrigin(path string, v any, name string, origins map[string]string) {
+	if m, ok := v.(map[string]any); ok && len(m) > 0 {
+		for k, sub := range m {
+			markOrigin(joinPath(path, k), sub, name, origins)
+		}
+		return
+	}
+	origins[path] = name
+}
+
+// copyValue deep copies maps and arrays of v.
+func copyValue(v any) any {
+	switch vt := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(vt))
+		for k, sub := range vt {
+			m[k] = copyValue(sub)
+		}
+		return m
+	case []any:
+		s := make([]any, len(vt))
+		for i, sub := range vt {
+			s[i] = copyValue(sub)
+		}
+		return s
+	default:
+		return v
+	}
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge(t *testing.T) {
+	newDst := func() map[string]any {
+		return map[string]any{
+			"name": "mcdull",
+			"redis": map[string]any{
+				"addr": "127.0.0.1:6379",
+			},
+			"hosts": []any{"a"},
+			"servers": []any{
+				map[string]any{"name": "s1", "port": 8080},
+			},
+		}
+	}
+	src := map[string]any{
+		"name":  "kk",
+		"redis": map[string]any{"db": 1},
+		"hosts": []any{"b"},
+		"servers": []any{
+			map[string]any{"name": "s1", "port": 8081},
+			map[string]any{"name": "s2", "port": 8082},
+		},
+	}
+
+	tests := []struct {
+		strategy MergeStrategy
+		name     string
+		hosts    []any
+		servers  []any
+	}{
+		{
+			strategy: MergeOverride,
+			name:     "kk",
+			hosts:    []any{"b"},
+			servers:  src["servers"].([]any),
+		},
+		{
+			strategy: MergeKeepExisting,
+			name:     "mcdull",
+			hosts:    []any{"a"},
+			servers:  newDst()["servers"].([]any),
+		},
+		{
+			strategy: MergeAppendSlices,
+			name:     "kk",
+			hosts:    []any{"a", "b"},
+			servers: []any{
+				map[string]any{"name": "s1", "port": 8080},
+				map[string]any{"name": "s1", "port": 8081},
+				map[string]any{"name": "s2", "port": 8082},
+			},
+		},
+		{
+			strategy: MergeSlicesByKey,
+			name:     "kk",
+			hosts:    []any{"a", "b"},
+			servers:  src["servers"].([]any),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy.String(), func(t *testing.T) {
+			dst := newDst()
+			origins := make(map[string]string)
+			s := newSource(nil, 0)
+			s.name = "src"
+			s.strategy = tt.strategy
+			merge("", dst, copyValue(src).(map[string]any), s, origins)
+			assert.Equal(t, tt.name, dst["name"])
+			assert.Equal(t, tt.hosts, dst["hosts"])
+			assert.Equal(t, tt.servers, dst["servers"])
+			assert.Equal(t, map[string]any{"addr": "127.0.0.1:6379", "db": 1}, dst["redis"])
+			assert.Equal(t, "src", origins["redis.db"])
+			assert.Empty(t, origins["redis.addr"])
+		})
+	}
+}
+
+func TestConfig_Priority(t *testing.T) {
+	env := newTestSource(&KeyValue{Key: "env.json", Format: "json", Value: []byte(`{"redis":{"addr":"redis:6379"}}`)})
+	file := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"redis":{"addr":"127.0.0.1:6379","db":1},"hosts":["a"]}`)})
+	remote := newTestSource(&KeyValue{Key: "remote.json", Format: "json", Value: []byte(`{"redis":{"addr":"remote:6379","db":2},"hosts":["b"]}`)})
+	c := New(
+		WithSourceOptions(env, WithPriority(100), WithSourceName("env")),
+		WithSource(file),
+		WithSourceOptions(remote, WithPriority(-1), WithMergeStrategy(MergeAppendSlices)),
+	)
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	assert.Equal(t, "redis:6379", c.Value("redis.addr").StringOrDefault(""))
+	assert.Equal(t, int64(1), c.Value("redis.db").IntOrDefault(0))
+	hosts, err := c.Value("hosts").Slice()
+	assert.Nil(t, err)
+	assert.Len(t, hosts, 1)
+
+	origin, ok := c.Origin("redis.addr")
+	assert.True(t, ok)
+	assert.Equal(t, "env", origin)
+	origin, _ = c.Origin("redis.db")
+	assert.Equal(t, "*config.testSource#1", origin)
+	_, ok = c.Origin("redis")
+	assert.False(t, ok)
+
+	// low priority update never overrides the higher ones
+	remote.push(&KeyValue{Key: "remote.json", Format: "json", Value: []byte(`{"redis":{"addr":"remote:6380","db":3,"pass":"foo"}}`)})
+	assert.Equal(t, "redis:6379", c.Value("redis.addr").StringOrDefault(""))
+	assert.Equal(t, int64(1), c.Value("redis.db").IntOrDefault(0))
+	assert.Equal(t, "foo", c.Value("redis.pass").StringOrDefault(""))
+}
+
+func TestConfig_DeletedKeyValue(t *testing.T) {
+	src := newTestSource(
+		&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull","redis":{"db":1}}`)},
+		&KeyValue{Key: "redis.json", Format: "json", Value: []byte(`{"redis":{"db":2}}`)},
+	)
+	c := New(WithSource(src))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, int64(2), c.Value("redis.db").IntOrDefault(0))
+
+	src.push(&KeyValue{Key: "redis.json", Deleted: true})
+	assert.Equal(t, int64(1), c.Value("redis.db").IntOrDefault(0))
+	src.push(&KeyValue{Key: "app.json", Deleted: true})
+	_, err := c.Value("name").String()
+	assert.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"errors"
+
+	"github.com/mcdull-kk/pkg/metric"
+)
+
+const namespace = "config"
+
+var (
+	metricValidationFailures = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "validation",
+		Name:      "failures_total",
+		Help:      "config validation failures by the source of the rejected update.",
+		Labels:    []string{"source"},
+	})
+	metricSourceHealthy = metric.NewGaugeVec(&metric.GaugeVecOpts{
+		Namespace: namespace,
+		Subsystem: "source",
+		Name:      "healthy",
+		Help:      "config source watcher health, 1 for healthy and 0 for failing.",
+		Labels:    []string{"source"},
+	})
+	metricSourceReconnects = metric.NewCounterVec(&metric.CounterVecOpts{
+		Namespace: namespace,
+		Subsystem: "source",
+		Name:      "reconnects_total",
+		Help:      "config source watcher re-creations.",
+		Labels:    []string{"source"},
+	})
+)
+
+// observeValidation counts the update of source rejected by schema.
+func observeValidation(source string, err error) {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		metricValidationFailures.Inc(source)
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"sync"
+
+	"github.com/mcdull-kk/pkg/rescue"
+)
+
+type (
+	// Cancel unsubscribes the observer it was returned with,
+	// it is safe to call more than once.
+	Cancel func()
+
+	subscription struct {
+		id     uint64
+		key    string
+		value  Observer
+		change ChangeObserver
+	}
+
+	// observers keeps subscriptions in registration order.
+	observers struct {
+		lock sync.RWMutex
+		seq  uint64
+		subs []*subscription
+	}
+)
+
+func (o *observers) add(sub *subscription) Cancel {
+	o.lock.Lock()
+	o.seq++
+	sub.id = o.seq
+	o.subs = append(o.subs, sub)
+	o.lock.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() { o.remove(sub.id) })
+	}
+}
+
+func (o *observers) remove(id uint64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for i, sub := range o.subs {
+		if sub.id == id {
+			o.subs = append(o.subs[:i:i], o.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (o *observers) snapshot() []*subscription {
+	o.lock.RLock()
+	defer o.lock.RUnlock()
+	return o.subs
+}
+
+// notifyKey calls every observer of key, a panicking observer
+// does not stop the rest.
+func (o *observers) notifyKey(key string, v Value) {
+	for _, sub := range o.snapshot() {
+		if sub.value != nil && sub.key == key {
+			func() {
+				defer rescue.Recover()
+				sub.value(key, v)
+			}()
+		}
+	}
+}
+
+// notifyChange calls every prefix observer which has changes under its prefix.
+func (o *observers) notifyChange(cs *ChangeSet) {
+	for _, sub := range o.snapshot() {
+		if sub.change == nil {
+			continue
+		}
+		if matched := cs.Prefix(sub.key); !matched.Empty() {
+			func() {
+				defer rescue.Recover()
+				sub.change(sub.key, matched)
+			}()
+		}
+	}
+}
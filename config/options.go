@@ -2,8 +2,8 @@ package config
 
 import (
 	"fmt"
-	"regexp"
 	"strings"
+	"time"
 
 	"github.com/mcdull-kk/pkg/codec"
 )
@@ -13,6 +13,12 @@ type (
 		Key    string
 		Value  []byte
 		Format string
+		// Deleted reports the key is removed from the source,
+		// its values are dropped from the merged config.
+		Deleted bool
+		// Secret reports the values are secrets, they are redacted
+		// and never written into the snapshot file.
+		Secret bool
 	}
 
 	Source interface {
@@ -28,20 +34,147 @@ type (
 )
 
 type (
-	Decoder  func(*KeyValue, map[string]any) error
-	Resolver func(map[string]any) error
-	Option   func(*options)
+	Decoder      func(*KeyValue, map[string]any) error
+	Resolver     func(map[string]any) error
+	Option       func(*options)
+	SourceOption func(*sourceOptions)
 
 	options struct {
-		sources  []Source
-		decoder  Decoder
-		resolver Resolver
+		sources      []*source
+		decoder      Decoder
+		resolver     Resolver
+		decrypter    Decrypter
+		secrets      map[string]SecretProvider
+		history      int
+		snapshotFile string
+		schema       *Schema
+		backoffMin   time.Duration
+		backoffMax   time.Duration
+	}
+
+	// sourceOptions controls how a source is merged with the others.
+	sourceOptions struct {
+		name     string
+		priority int
+		strategy MergeStrategy
+		mergeKey string
+	}
+
+	source struct {
+		Source
+		sourceOptions
+		order int
 	}
 )
 
+// WithSource appends sources with default priority, sources
+// of the same priority are merged in registration order.
 func WithSource(s ...Source) Option {
 	return func(o *options) {
-		o.sources = s
+		for _, src := range s {
+			o.sources = append(o.sources, newSource(src, len(o.sources)))
+		}
+	}
+}
+
+// WithSourceOptions appends a source with its priority and merge strategy.
+func WithSourceOptions(s Source, opts ...SourceOption) Option {
+	return func(o *options) {
+		src := newSource(s, len(o.sources))
+		for _, opt := range opts {
+			opt(&src.sourceOptions)
+		}
+		o.sources = append(o.sources, src)
+	}
+}
+
+// WithDecrypter sets the Decrypter of ENC(...) values.
+func WithDecrypter(d Decrypter) Option {
+	return func(o *options) {
+		o.decrypter = d
+	}
+}
+
+// WithSecretProvider registers p for ${secret:scheme:ref} values.
+func WithSecretProvider(scheme string, p SecretProvider) Option {
+	return func(o *options) {
+		o.secrets[scheme] = p
+	}
+}
+
+// WithHistory sets how many versions of the merged config are kept
+// for Diff and Rollback. Default is 10.
+func WithHistory(n int) Option {
+	return func(o *options) {
+		o.history = n
+	}
+}
+
+// WithSnapshotFile persists the latest merged config to file, Load
+// falls back to it when a source fails to load.
+func WithSnapshotFile(file string) Option {
+	return func(o *options) {
+		o.snapshotFile = file
+	}
+}
+
+// WithSchema validates the merged config on Load and every update,
+// an invalid update is rejected and the current config is kept.
+func WithSchema(s *Schema) Option {
+	return func(o *options) {
+		o.schema = s
+	}
+}
+
+// WithWatchBackoff sets the delay range of retrying a failed source
+// watcher, the delay doubles from min to max with jitter. Default is 1s to 1m.
+func WithWatchBackoff(min, max time.Duration) Option {
+	return func(o *options) {
+		o.backoffMin = min
+		o.backoffMax = max
+	}
+}
+
+// WithPriority sets source priority, the higher priority source
+// is merged later and overrides the lower ones. Default is 0.
+func WithPriority(p int) SourceOption {
+	return func(o *sourceOptions) {
+		o.priority = p
+	}
+}
+
+// WithMergeStrategy sets how the source is merged into
+// the config merged before it. Default is MergeOverride.
+func WithMergeStrategy(s MergeStrategy) SourceOption {
+	return func(o *sourceOptions) {
+		o.strategy = s
+	}
+}
+
+// WithMergeKey sets the field used to match array items
+// for MergeSlicesByKey. Default is "name".
+func WithMergeKey(key string) SourceOption {
+	return func(o *sourceOptions) {
+		o.mergeKey = key
+	}
+}
+
+// WithSourceName names the source in Origin, default is type#index.
+func WithSourceName(name string) SourceOption {
+	return func(o *sourceOptions) {
+		o.name = name
+	}
+}
+
+func newSource(s Source, order int) *source {
+	return &source{
+		Source: s,
+		sourceOptions: sourceOptions{
+			name:     fmt.Sprintf("%T#%d", s, order),
+			strategy: MergeOverride,
+			mergeKey: "name",
+		},
+		order: order,
 	}
 }
 
@@ -79,56 +212,3 @@ func defaultDecoder(src *KeyValue, target map[string]any) error {
 	}
 	return fmt.Errorf("unsupported key: %s format: %s", src.Key, src.Format)
 }
-
-// defaultResolver resolve placeholder in map value,
-// placeholder format in ${key:default}.
-func defaultResolver(input map[string]any) error {
-	mapper := func(name string) string {
-		args := strings.SplitN(strings.TrimSpace(name), ":", 2) //nolint:gomnd
-		if v, has := readValue(input, args[0]); has {
-			return codec.Repr(v.Load())
-		} else if len(args) > 1 { // default value
-			return args[1]
-		}
-		return ""
-	}
-
-	var resolve func(map[string]any) error
-	resolve = func(sub map[string]any) error {
-		for k, v := range sub {
-			switch vt := v.(type) {
-			case string:
-				sub[k] = expand(vt, mapper)
-			case map[string]any:
-				if err := resolve(vt); err != nil {
-					return err
-				}
-			case []any:
-				for i, iface := range vt {
-					switch it := iface.(type) {
-					case string:
-						vt[i] = expand(it, mapper)
-					case map[string]any:
-						if err := resolve(it); err != nil {
-							return err
-						}
-					}
-				}
-				sub[k] = vt
-			}
-		}
-		return nil
-	}
-	return resolve(input)
-}
-
-func expand(s string, mapping func(string) string) string {
-	r := regexp.MustCompile(`\${(.*?)}`)
-	re := r.FindAllStringSubmatch(s, -1)
-	for _, i := range re {
-		if len(i) == 2 { //nolint:gomnd
-			s = strings.ReplaceAll(s, i[0], mapping(i[1]))
-		}
-	}
-	return s
-}
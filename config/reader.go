@@ -4,76 +4,338 @@ import (
 	"bytes"
 	"encoding/gob"
 	"fmt"
+	"math"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
+	"time"
 
-	"github.com/imdario/mergo"
 	"github.com/mcdull-kk/pkg/codec"
 	"github.com/mcdull-kk/pkg/log"
 )
 
 type (
 	Reader interface {
-		Merge(...*KeyValue) error
-		Value(string) (*atomic.Value, bool)
+		Merge(string, ...*KeyValue) error
+		Value(string) (Value, bool)
+		Values() (map[string]any, error)
+		Origin(string) (string, bool)
+		Redacted() map[string]any
 		Source() ([]byte, error)
 		Resolve() error
+		Remove(string)
+		History() []*Snapshot
+		Diff(uint64, uint64) (*ChangeSet, error)
+		Rollback(uint64) error
 	}
 
 	reader struct {
-		opts   options
-		values map[string]any
-		lock   sync.Mutex
+		opts    options
+		values  map[string]any
+		origins map[string]string
+		secrets map[string]struct{}
+		layers  map[string]*layer
+		history []*revision
+		lock    sync.Mutex
+	}
+
+	// layer holds the decoded KeyValues of a source by key.
+	layer struct {
+		src     *source
+		keys    []string
+		kvs     map[string]map[string]any
+		secrets map[string]struct{}
 	}
 )
 
 func newReader(opts options) Reader {
 	return &reader{
-		opts:   opts,
-		values: make(map[string]any),
-		lock:   sync.Mutex{},
+		opts:    opts,
+		values:  make(map[string]any),
+		origins: make(map[string]string),
+		secrets: make(map[string]struct{}),
+		layers:  make(map[string]*layer),
+		lock:    sync.Mutex{},
 	}
 }
 
-func (r *reader) Merge(kvs ...*KeyValue) error {
-	merged, err := r.cloneMap()
-	if err != nil {
-		return err
-	}
+// Merge decodes kvs into the layer of the named source, a KeyValue
+// replaces the one delivered before with the same key and a deleted
+// KeyValue removes it. The merged config is rebuilt by Resolve.
+func (r *reader) Merge(name string, kvs ...*KeyValue) error {
+	decoded := make([]map[string]any, 0, len(kvs))
 	for _, kv := range kvs {
+		if kv.Deleted {
+			decoded = append(decoded, nil)
+			continue
+		}
 		next := make(map[string]any)
 		if err := r.opts.decoder(kv, next); err != nil {
-			log.Errorf("Failed to config decode error: %v key: %s value: %s", err, kv.Key, string(kv.Value))
-			return err
-		}
-		if err := mergo.Map(&merged, convertMap(next), mergo.WithOverride); err != nil {
-			log.Errorf("Failed to config merge error: %v key: %s value: %s", err, kv.Key, string(kv.Value))
+			log.Errorf("Failed to config decode error: %v key: %s", err, kv.Key)
 			return err
 		}
+		decoded = append(decoded, convertMap(next).(map[string]any))
 	}
 	r.lock.Lock()
-	r.values = merged
-	r.lock.Unlock()
+	defer r.lock.Unlock()
+	l := r.layer(name)
+	for i, kv := range kvs {
+		if kv.Deleted {
+			l.remove(kv.Key)
+			continue
+		}
+		if _, ok := l.kvs[kv.Key]; !ok {
+			l.keys = append(l.keys, kv.Key)
+		}
+		l.kvs[kv.Key] = decoded[i]
+		if kv.Secret {
+			l.secrets[kv.Key] = struct{}{}
+		} else {
+			delete(l.secrets, kv.Key)
+		}
+	}
 	return nil
 }
 
-func (r *reader) Value(path string) (*atomic.Value, bool) {
+func (l *layer) remove(key string) {
+	if _, ok := l.kvs[key]; !ok {
+		return
+	}
+	delete(l.kvs, key)
+	delete(l.secrets, key)
+	for i, k := range l.keys {
+		if k == key {
+			l.keys = append(l.keys[:i:i], l.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (r *reader) layer(name string) *layer {
+	if l, ok := r.layers[name]; ok {
+		return l
+	}
+	var src *source
+	for _, s := range r.opts.sources {
+		if s.name == name {
+			src = s
+			break
+		}
+	}
+	if src == nil {
+		src = newSource(nil, len(r.opts.sources)+len(r.layers))
+		src.name = name
+		if name == snapshotLayer {
+			src.priority = math.MinInt
+		}
+	}
+	l := &layer{src: src, kvs: make(map[string]map[string]any), secrets: make(map[string]struct{})}
+	r.layers[name] = l
+	return l
+}
+
+func (r *reader) Value(path string) (Value, bool) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 	return readValue(r.values, path)
 }
 
+// Values returns a deep copy of the merged config.
+func (r *reader) Values() (map[string]any, error) {
+	return r.cloneMap()
+}
+
 func (r *reader) Source() ([]byte, error) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 	return codec.GetCodec(codec.JsonName).Marshal(r.values)
 }
 
+// Origin returns the name of the source which the leaf path came from.
+func (r *reader) Origin(path string) (string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	name, ok := r.origins[path]
+	return name, ok
+}
+
+// Redacted returns a copy of the merged config with secrets masked.
+func (r *reader) Redacted() map[string]any {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return redact(r.values, r.secrets)
+}
+
+// Resolve merges all the layers by priority, resolves placeholders
+// and secrets, validates by schema and then replaces the merged config.
+// The layers are restored to the current config if any step fails.
 func (r *reader) Resolve() error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
-	return r.opts.resolver(r.values)
+	if err := r.resolve(); err != nil {
+		if last := len(r.history) - 1; last >= 0 {
+			r.layers = cloneLayers(r.history[last].layers)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *reader) resolve() error {
+	layers := make([]*layer, 0, len(r.layers))
+	for _, l := range r.layers {
+		layers = append(layers, l)
+	}
+	sort.Slice(layers, func(i, j int) bool {
+		if layers[i].src.priority != layers[j].src.priority {
+			return layers[i].src.priority < layers[j].src.priority
+		}
+		return layers[i].src.order < layers[j].src.order
+	})
+	var (
+		merged  = make(map[string]any)
+		origins = make(map[string]string)
+		// sourced are the leaf paths of the secret KeyValues
+		sourced = make(map[string]any)
+	)
+	for _, l := range layers {
+		for _, key := range l.keys {
+			merge("", merged, copyValue(l.kvs[key]).(map[string]any), l.src, origins)
+			if _, ok := l.secrets[key]; ok {
+				flatten("", l.kvs[key], sourced)
+			}
+		}
+	}
+	// raw keeps all the placeholders and escapes as they are merged,
+	// so the snapshot file is resolved again the same way
+	raw := copyValue(merged).(map[string]any)
+	for path := range sourced {
+		deletePath(raw, path)
+	}
+	if err := r.opts.resolver(merged); err != nil {
+		return err
+	}
+	// secret and file placeholders are resolved after the other
+	// placeholders, so the value referencing them is secret as well
+	secrets, err := resolveSecrets(merged, &r.opts)
+	if err != nil {
+		return err
+	}
+	for path := range sourced {
+		secrets[path] = struct{}{}
+	}
+	if r.opts.schema != nil {
+		if err = r.opts.schema.Validate(merged); err != nil {
+			return err
+		}
+	}
+	leaves := make(map[string]any)
+	flatten("", merged, leaves)
+	for path := range origins {
+		if _, ok := leaves[path]; !ok {
+			delete(origins, path)
+		}
+	}
+	r.commit(&revision{
+		values:  merged,
+		raw:     raw,
+		origins: origins,
+		secrets: secrets,
+		layers:  cloneLayers(r.layers),
+	})
+	return nil
+}
+
+// Remove drops the layer of the named source, the merged
+// config is rebuilt by Resolve.
+func (r *reader) Remove(name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.layers, name)
+}
+
+// History returns the kept versions from the oldest to the latest.
+func (r *reader) History() []*Snapshot {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	snapshots := make([]*Snapshot, 0, len(r.history))
+	for _, rev := range r.history {
+		snapshots = append(snapshots, rev.snapshot())
+	}
+	return snapshots
+}
+
+// Diff returns the changes from version v1 to v2.
+func (r *reader) Diff(v1, v2 uint64) (*ChangeSet, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	from, ok := r.revision(v1)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrVersionNotFound, v1)
+	}
+	to, ok := r.revision(v2)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrVersionNotFound, v2)
+	}
+	return diffRevision(from, to), nil
+}
+
+// Rollback commits the merged config and the layers of version
+// as a new version, later updates are merged on top of them.
+func (r *reader) Rollback(version uint64) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	rev, ok := r.revision(version)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+	r.layers = cloneLayers(rev.layers)
+	r.commit(&revision{
+		values:  rev.values,
+		raw:     rev.raw,
+		origins: rev.origins,
+		secrets: rev.secrets,
+		layers:  cloneLayers(rev.layers),
+	})
+	return nil
+}
+
+func (r *reader) revision(version uint64) (*revision, bool) {
+	for _, rev := range r.history {
+		if rev.version == version {
+			return rev, true
+		}
+	}
+	return nil, false
+}
+
+// commit replaces the merged config and records it as a new version
+// if it changed, the oldest versions are dropped beyond the limit.
+func (r *reader) commit(rev *revision) {
+	r.values = rev.values
+	r.origins = rev.origins
+	r.secrets = rev.secrets
+	last := len(r.history) - 1
+	if last >= 0 && reflect.DeepEqual(r.history[last].values, rev.values) {
+		r.history[last].layers = rev.layers
+		return
+	}
+	rev.time = time.Now()
+	if last >= 0 {
+		rev.version = r.history[last].version + 1
+	} else {
+		rev.version = 1
+	}
+	r.history = append(r.history, rev)
+	if limit := r.opts.history; limit > 0 && len(r.history) > limit {
+		r.history = append(r.history[:0:0], r.history[len(r.history)-limit:]...)
+	}
+	if r.opts.snapshotFile != "" {
+		if err := saveSnapshot(r.opts.snapshotFile, rev.raw); err != nil {
+			log.Errorf("failed to save config snapshot: %v", err)
+		}
+	}
 }
 
 func (r *reader) cloneMap() (map[string]any, error) {
@@ -131,7 +393,7 @@ func convertMap(src any) any {
 
 // readValue read Value in given map[string]any
 // by the given path, will return false if not found.
-func readValue(values map[string]any, path string) (*atomic.Value, bool) {
+func readValue(values map[string]any, path string) (Value, bool) {
 	var (
 		next = values
 		keys = strings.Split(path, ".")
@@ -143,9 +405,7 @@ func readValue(values map[string]any, path string) (*atomic.Value, bool) {
 			return nil, false
 		}
 		if idx == last {
-			av := &atomic.Value{}
-			av.Store(value)
-			return av, true
+			return newValue(value), true
 		}
 		switch vm := value.(type) {
 		case map[string]any:
@@ -156,3 +416,16 @@ func readValue(values map[string]any, path string) (*atomic.Value, bool) {
 	}
 	return nil, false
 }
+
+// deletePath removes the dotted path from values.
+func deletePath(values map[string]any, path string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		sub, ok := values[key].(map[string]any)
+		if !ok {
+			return
+		}
+		values = sub
+	}
+	delete(values, keys[len(keys)-1])
+}
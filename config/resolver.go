@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mcdull-kk/pkg/codec"
+)
+
+// ErrPlaceholderCycle is a placeholder which references itself.
+var ErrPlaceholderCycle = errors.New("placeholder cycle")
+
+var placeholderRegexp = regexp.MustCompile(`^\${([^}]*)}$`)
+
+// placeholders resolves the placeholders of input in place,
+// a referenced value is resolved before it is used.
+type placeholders struct {
+	input     map[string]any
+	done      map[string]struct{}
+	resolving []string
+}
+
+// defaultResolver resolve placeholder in map value, placeholder format in
+// ${key:default} and ${env:NAME:default}. $${...} is escaped as is,
+// ${secret:...} and ${file:path:default} are left with their escapes to
+// secret resolving. A placeholder which is the whole string keeps the type
+// of the referenced value.
+func defaultResolver(input map[string]any) error {
+	p := &placeholders{input: input, done: make(map[string]struct{})}
+	for k := range input {
+		if err := p.resolveEntry(input, k, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *placeholders) resolveEntry(m map[string]any, key, path string) error {
+	if _, ok := p.done[path]; ok {
+		return nil
+	}
+	for i, resolving := range p.resolving {
+		if resolving == path {
+			return fmt.Errorf("%w: %s -> %s", ErrPlaceholderCycle, strings.Join(p.resolving[i:], " -> "), path)
+		}
+	}
+	p.resolving = append(p.resolving, path)
+	v, err := p.resolveValue(path, m[key])
+	p.resolving = p.resolving[:len(p.resolving)-1]
+	if err != nil {
+		return err
+	}
+	m[key] = v
+	p.done[path] = struct{}{}
+	return nil
+}
+
+func (p *placeholders) resolveValue(path string, v any) (any, error) {
+	switch vt := v.(type) {
+	case string:
+		return p.resolveString(path, vt)
+	case map[string]any:
+		for k := range vt {
+			if err := p.resolveEntry(vt, k, joinPath(path, k)); err != nil {
+				return nil, err
+			}
+		}
+	case []any:
+		for i, item := range vt {
+			next, err := p.resolveValue(path, item)
+			if err != nil {
+				return nil, err
+			}
+			vt[i] = next
+		}
+	}
+	return v, nil
+}
+
+func (p *placeholders) resolveString(path, s string) (any, error) {
+	if m := placeholderRegexp.FindStringSubmatch(s); m != nil {
+		v, err := p.lookup(path, m[1])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(string); !ok {
+			return copyValue(v), nil
+		}
+		return v, nil
+	}
+	var err error
+	s = expandFunc(s, func(name string) bool {
+		return !deferred(name)
+	}, func(name string) string {
+		v, e := p.lookup(path, name)
+		if e != nil && err == nil {
+			err = e
+		}
+		return codec.Repr(v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// lookup returns the value of placeholder name, the missing key
+// without default is resolved as empty string.
+func (p *placeholders) lookup(path, name string) (any, error) {
+	name = strings.TrimSpace(name)
+	scheme, ref, ok := strings.Cut(name, ":")
+	switch {
+	case deferred(name):
+		// left to secret resolving
+		return "${" + name + "}", nil
+	case ok && scheme == "env":
+		key, def, hasDef := strings.Cut(ref, ":")
+		if v, found := os.LookupEnv(key); found {
+			return v, nil
+		}
+		if hasDef {
+			return def, nil
+		}
+		return "", nil
+	}
+	key, def, hasDef := strings.Cut(name, ":")
+	if m, k, found := p.entry(key); found {
+		if err := p.resolveEntry(m, k, key); err != nil {
+			return nil, err
+		}
+		return m[k], nil
+	}
+	if hasDef {
+		return def, nil
+	}
+	return "", nil
+}
+
+// entry returns the map holding the dotted path and the last key.
+func (p *placeholders) entry(path string) (map[string]any, string, bool) {
+	var (
+		m    = p.input
+		keys = strings.Split(path, ".")
+		last = len(keys) - 1
+	)
+	for _, key := range keys[:last] {
+		sub, ok := m[key].(map[string]any)
+		if !ok {
+			return nil, "", false
+		}
+		m = sub
+	}
+	if _, ok := m[keys[last]]; !ok {
+		return nil, "", false
+	}
+	return m, keys[last], true
+}
+
+// deferred reports whether the placeholder name is resolved as a secret.
+func deferred(name string) bool {
+	scheme, _, ok := strings.Cut(strings.TrimSpace(name), ":")
+	return ok && (scheme == "secret" || scheme == "file")
+}
+
+// expand replaces ${name} in s by mapping, $${name} is unescaped
+// as ${name} and an unclosed ${ is kept as is.
+func expand(s string, mapping func(string) string) string {
+	return expandFunc(s, func(string) bool { return true }, mapping)
+}
+
+// expandFunc is like expand, but $${name} is kept as is unless
+// unescape(name), so that a later pass still sees the escape.
+func expandFunc(s string, unescape func(string) bool, mapping func(string) string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := strings.Index(s[i:], "}")
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i])
+			if end < 0 || unescape(s[i+2:i+end]) {
+				b.WriteString("{")
+			} else {
+				b.WriteString("${")
+			}
+			s = s[i+2:]
+			continue
+		}
+		if end < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:i])
+		b.WriteString(mapping(s[i+2 : i+end]))
+		s = s[i+end+1:]
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultResolver_References(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(file, []byte("abc\n"), 0o600))
+	t.Setenv("CONFIG_TEST_HOST", "10.0.0.1")
+
+	data := map[string]any{
+		"a":     "${b}",
+		"b":     "${c.port}",
+		"c":     map[string]any{"port": float64(8080), "host": "${env:CONFIG_TEST_HOST}"},
+		"addr":  "${c.host}:${a}",
+		"redis": "${c}",
+		"list":  []any{"${a}", "x${a}"},
+		"env":   "${env:CONFIG_TEST_NOTEXIST:dev}",
+		"token": "${file:" + file + "}",
+		"esc":   "$${a} and ${a}",
+		"enc":   "${secret:file:/run/secrets/x}",
+		"raw":   "$${secret:file:/run/secrets/x}",
+	}
+	assert.Nil(t, defaultResolver(data))
+	assert.Equal(t, float64(8080), data["a"])
+	assert.Equal(t, float64(8080), data["b"])
+	assert.Equal(t, "10.0.0.1:8080", data["addr"])
+	assert.Equal(t, map[string]any{"port": float64(8080), "host": "10.0.0.1"}, data["redis"])
+	assert.Equal(t, []any{float64(8080), "x8080"}, data["list"])
+	assert.Equal(t, "dev", data["env"])
+	assert.Equal(t, "${file:"+file+"}", data["token"])
+	assert.Equal(t, "${a} and 8080", data["esc"])
+	assert.Equal(t, "${secret:file:/run/secrets/x}", data["enc"])
+	assert.Equal(t, "$${secret:file:/run/secrets/x}", data["raw"])
+}
+
+func TestDefaultResolver_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]any
+		cycle bool
+	}{
+		{
+			name:  "self",
+			input: map[string]any{"a": "x${a}"},
+			cycle: true,
+		},
+		{
+			name:  "indirect",
+			input: map[string]any{"a": "${b}", "b": map[string]any{"c": "${a}"}},
+			cycle: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := defaultResolver(tt.input)
+			assert.NotNil(t, err)
+			assert.Equal(t, tt.cycle, errors.Is(err, ErrPlaceholderCycle))
+		})
+	}
+}
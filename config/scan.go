@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/mcdull-kk/pkg/log"
+	"github.com/mcdull-kk/pkg/rescue"
+)
+
+var errNotBindable = errors.New("scan watch target must be a non-nil pointer to struct")
+
+type (
+	// ScanObserver is notified with the previous and the next
+	// snapshot once the whole struct is re-bound, old is nil
+	// for the initial snapshot.
+	ScanObserver func(old, new any)
+
+	scanner struct {
+		typ      reflect.Type
+		current  atomic.Value
+		observer ScanObserver
+	}
+
+	// Watched holds the latest valid snapshot of T, it is safe
+	// for concurrent use.
+	Watched[T any] struct {
+		v atomic.Value
+	}
+)
+
+// NewWatched binds the config into a new T and keeps it refreshed,
+// o is optional and called after each new snapshot is published.
+func NewWatched[T any](c Config, o func(old, new *T)) (*Watched[T], error) {
+	w := &Watched[T]{}
+	err := c.ScanWatch(new(T), func(old, new any) {
+		w.v.Store(new)
+		if o != nil && old != nil {
+			o(old.(*T), new.(*T))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Load returns the latest valid snapshot, it must not be modified.
+func (w *Watched[T]) Load() *T {
+	return w.v.Load().(*T)
+}
+
+// rescan binds values into a fresh struct, the snapshot is published
+// only if binding and validation pass, otherwise the last good one is kept.
+func (s *scanner) rescan(values map[string]any) {
+	next := reflect.New(s.typ).Interface()
+	if err := bind(values, next); err != nil {
+		log.Errorf("failed to rescan config into %v: %v", s.typ, err)
+		return
+	}
+	old := s.current.Load()
+	if reflect.DeepEqual(old, next) {
+		return
+	}
+	s.current.Store(next)
+	func() {
+		defer rescue.Recover()
+		s.observer(old, next)
+	}()
+}
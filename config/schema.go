@@ -0,0 +1,543 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type (
+	// Schema validates the merged config before it replaces the current
+	// one, see WithSchema. It supports the JSON Schema keywords type,
+	// properties, required, additionalProperties, items, enum, const,
+	// minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength,
+	// maxLength, pattern, minItems and maxItems, the other keywords are
+	// rejected except annotations like title and description.
+	Schema struct {
+		root *schemaNode
+	}
+
+	// ValidationError reports all the violations of the schema.
+	ValidationError struct {
+		Errors []error
+	}
+
+	schemaNode struct {
+		Type                 schemaTypes            `json:"type"`
+		Properties           map[string]*schemaNode `json:"properties"`
+		Required             []string               `json:"required"`
+		AdditionalProperties *schemaNode            `json:"additionalProperties"`
+		Items                *schemaNode            `json:"items"`
+		Enum                 []any                  `json:"enum"`
+		Const                *any                   `json:"const"`
+		Minimum              *float64               `json:"minimum"`
+		Maximum              *float64               `json:"maximum"`
+		ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+		ExclusiveMaximum     *float64               `json:"exclusiveMaximum"`
+		MinLength            *int                   `json:"minLength"`
+		MaxLength            *int                   `json:"maxLength"`
+		Pattern              string                 `json:"pattern"`
+		MinItems             *int                   `json:"minItems"`
+		MaxItems             *int                   `json:"maxItems"`
+
+		// never is the false schema
+		never bool
+		// lenient accepts strings convertible to the type and matches
+		// properties case-insensitively, like bind does
+		lenient bool
+		pattern *regexp.Regexp
+	}
+
+	schemaTypes []string
+
+	// seenTypes are the struct types being derived, to stop at recursive types.
+	seenTypes map[reflect.Type]struct{}
+
+	validator struct {
+		errs []error
+	}
+)
+
+// keywords are the supported keywords and the annotations
+// which do not affect validation.
+var keywords = map[string]struct{}{
+	"type": {}, "properties": {}, "required": {}, "additionalProperties": {},
+	"items": {}, "enum": {}, "const": {}, "minimum": {}, "maximum": {},
+	"exclusiveMinimum": {}, "exclusiveMaximum": {}, "minLength": {},
+	"maxLength": {}, "pattern": {}, "minItems": {}, "maxItems": {},
+
+	"$schema": {}, "$id": {}, "$comment": {}, "title": {}, "description": {},
+	"default": {}, "examples": {}, "deprecated": {}, "readOnly": {}, "writeOnly": {},
+}
+
+// NewSchema parses a JSON Schema document.
+func NewSchema(data []byte) (*Schema, error) {
+	root := &schemaNode{}
+	if err := json.Unmarshal(data, root); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if err := root.compile(); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &Schema{root: root}, nil
+}
+
+// SchemaOf derives a Schema from the struct pointed by v with the same
+// rules as Scan: field names, optional, default, options, range and env tags.
+func SchemaOf(v any) (*Schema, error) {
+	rt := reflect.TypeOf(v)
+	for rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema of %T is not supported, expect struct", v)
+	}
+	root, err := structSchema(rt, make(seenTypes))
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+// Validate reports all the violations of values, the violated
+// values are not included in the error since they may be secrets.
+func (s *Schema) Validate(values map[string]any) error {
+	vd := &validator{}
+	vd.validate("", values, s.root)
+	if len(vd.errs) > 0 {
+		return &ValidationError{Errors: vd.errs}
+	}
+	return nil
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (n *schemaNode) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		n.never = !b
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	var unknown []string
+	for key := range fields {
+		if _, ok := keywords[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unsupported keywords %s", strings.Join(unknown, ", "))
+	}
+	type node schemaNode
+	return json.Unmarshal(data, (*node)(n))
+}
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = schemaTypes{s}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+func (n *schemaNode) compile() error {
+	if n.Pattern != "" {
+		re, err := regexp.Compile(n.Pattern)
+		if err != nil {
+			return err
+		}
+		n.pattern = re
+	}
+	for _, sub := range n.Properties {
+		if err := sub.compile(); err != nil {
+			return err
+		}
+	}
+	for _, sub := range []*schemaNode{n.AdditionalProperties, n.Items} {
+		if sub == nil {
+			continue
+		}
+		if err := sub.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (vd *validator) fail(path string, format string, a ...any) {
+	if path == "" {
+		path = "(root)"
+	}
+	vd.errs = append(vd.errs, fmt.Errorf("%s: %s", path, fmt.Sprintf(format, a...)))
+}
+
+func (vd *validator) validate(path string, v any, n *schemaNode) {
+	if n.never {
+		vd.fail(path, "is not allowed")
+		return
+	}
+	if len(n.Type) > 0 && !n.Type.match(v, n.lenient) {
+		vd.fail(path, "expect %s, got %s", strings.Join(n.Type, " or "), jsonType(v))
+		return
+	}
+	if len(n.Enum) > 0 {
+		found := false
+		for _, e := range n.Enum {
+			if equalJSON(e, v, n.lenient) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			vd.fail(path, "value is not one of %s", reprJSON(n.Enum))
+		}
+	}
+	if n.Const != nil && !equalJSON(*n.Const, v, n.lenient) {
+		vd.fail(path, "value is not %s", reprJSON(*n.Const))
+	}
+	if f, ok := toNumber(v, n.lenient); ok {
+		vd.number(path, f, n)
+	}
+	switch vt := v.(type) {
+	case string:
+		vd.string(path, vt, n)
+	case []any:
+		vd.array(path, vt, n)
+	case map[string]any:
+		vd.object(path, vt, n)
+	}
+}
+
+func (vd *validator) number(path string, f float64, n *schemaNode) {
+	if n.Minimum != nil && f < *n.Minimum {
+		vd.fail(path, "value is less than %v", *n.Minimum)
+	}
+	if n.Maximum != nil && f > *n.Maximum {
+		vd.fail(path, "value is greater than %v", *n.Maximum)
+	}
+	if n.ExclusiveMinimum != nil && f <= *n.ExclusiveMinimum {
+		vd.fail(path, "value is not greater than %v", *n.ExclusiveMinimum)
+	}
+	if n.ExclusiveMaximum != nil && f >= *n.ExclusiveMaximum {
+		vd.fail(path, "value is not less than %v", *n.ExclusiveMaximum)
+	}
+}
+
+func (vd *validator) string(path, s string, n *schemaNode) {
+	length := utf8.RuneCountInString(s)
+	if n.MinLength != nil && length < *n.MinLength {
+		vd.fail(path, "length is less than %d", *n.MinLength)
+	}
+	if n.MaxLength != nil && length > *n.MaxLength {
+		vd.fail(path, "length is greater than %d", *n.MaxLength)
+	}
+	if n.pattern != nil && !n.pattern.MatchString(s) {
+		vd.fail(path, "value does not match %q", n.Pattern)
+	}
+}
+
+func (vd *validator) array(path string, items []any, n *schemaNode) {
+	if n.MinItems != nil && len(items) < *n.MinItems {
+		vd.fail(path, "items are fewer than %d", *n.MinItems)
+	}
+	if n.MaxItems != nil && len(items) > *n.MaxItems {
+		vd.fail(path, "items are more than %d", *n.MaxItems)
+	}
+	if n.Items == nil {
+		return
+	}
+	for i, item := range items {
+		vd.validate(fmt.Sprintf("%s[%d]", path, i), item, n.Items)
+	}
+}
+
+func (vd *validator) object(path string, m map[string]any, n *schemaNode) {
+	find := func(key string) (any, bool) {
+		if n.lenient {
+			return lookup(m, key)
+		}
+		v, ok := m[key]
+		return v, ok
+	}
+	for _, key := range n.Required {
+		if _, ok := find(key); !ok {
+			vd.fail(joinPath(path, key), "field is required")
+		}
+	}
+	keys := make([]string, 0, len(n.Properties))
+	for key := range n.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if v, ok := find(key); ok {
+			vd.validate(joinPath(path, key), v, n.Properties[key])
+		}
+	}
+	if n.AdditionalProperties == nil {
+		return
+	}
+	for _, key := range sortedKeys(m) {
+		if n.hasProperty(key) {
+			continue
+		}
+		vd.validate(joinPath(path, key), m[key], n.AdditionalProperties)
+	}
+}
+
+func (n *schemaNode) hasProperty(key string) bool {
+	if _, ok := n.Properties[key]; ok {
+		return true
+	}
+	if n.lenient {
+		for k := range n.Properties {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t schemaTypes) match(v any, lenient bool) bool {
+	for _, typ := range t {
+		switch typ {
+		case "null":
+			if v == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+			if s, ok := v.(string); ok && lenient {
+				if _, err := strconv.ParseBool(s); err == nil {
+					return true
+				}
+			}
+		case "integer":
+			if f, ok := toNumber(v, lenient); ok && f == float64(int64(f)) {
+				return true
+			}
+		case "number":
+			if _, ok := toNumber(v, lenient); ok {
+				return true
+			}
+		default:
+			if jsonType(v) == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type name of a decoded value.
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	if _, ok := toNumber(v, false); ok {
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func toNumber(v any, lenient bool) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		if lenient {
+			f, err := strconv.ParseFloat(rv.String(), 64)
+			return f, err == nil
+		}
+	}
+	return 0, false
+}
+
+// equalJSON compares decoded values, numbers of any type are equal
+// by value and lenient compares the string form like bind options.
+func equalJSON(a, b any, lenient bool) bool {
+	fa, aok := toNumber(a, false)
+	fb, bok := toNumber(b, false)
+	if aok && bok {
+		return fa == fb
+	}
+	if lenient {
+		return reprJSON(a) == reprJSON(b)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func reprJSON(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// structSchema derives the schema of struct type rt, a recursive
+// reference to rt is any object.
+func structSchema(rt reflect.Type, seen seenTypes) (*schemaNode, error) {
+	n := &schemaNode{
+		Type:       schemaTypes{"object"},
+		Properties: make(map[string]*schemaNode),
+		lenient:    true,
+	}
+	if _, ok := seen[rt]; ok {
+		return n, nil
+	}
+	seen[rt] = struct{}{}
+	defer delete(seen, rt)
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		opts, err := parseFieldOptions(field, tag)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.Name, err)
+		}
+		ft := field.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		// embedded struct without name is inlined
+		if field.Anonymous && tagName(tag) == "" && ft.Kind() == reflect.Struct {
+			sub, err := structSchema(ft, seen)
+			if err != nil {
+				return nil, err
+			}
+			for k, p := range sub.Properties {
+				n.Properties[k] = p
+			}
+			n.Required = append(n.Required, sub.Required...)
+			continue
+		}
+		p, err := typeSchema(ft, seen)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", opts.name, err)
+		}
+		if err := p.applyOptions(ft, opts); err != nil {
+			return nil, fmt.Errorf("%s: %w", opts.name, err)
+		}
+		n.Properties[opts.name] = p
+		required := !opts.optional && !opts.hasDefault && opts.env == ""
+		if ft.Kind() == reflect.Struct && len(p.Required) == 0 {
+			// nested struct may be fully covered by defaults
+			required = false
+		}
+		if required {
+			n.Required = append(n.Required, opts.name)
+		}
+	}
+	return n, nil
+}
+
+func typeSchema(rt reflect.Type, seen seenTypes) (*schemaNode, error) {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	n := &schemaNode{lenient: true}
+	ptr := reflect.PtrTo(rt)
+	if rt == durationType || ptr.Implements(textUnmarshalerType) || ptr.Implements(jsonUnmarshalerType) {
+		// the value is parsed by the type itself
+		return n, nil
+	}
+	switch rt.Kind() {
+	case reflect.Struct:
+		return structSchema(rt, seen)
+	case reflect.Map:
+		elem, err := typeSchema(rt.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		n.Type = schemaTypes{"object"}
+		n.AdditionalProperties = elem
+	case reflect.Slice, reflect.Array:
+		// default value of slice may be written in json string
+		items, err := typeSchema(rt.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		n.Type = schemaTypes{"array", "string"}
+		n.Items = items
+	case reflect.String:
+		n.Type = schemaTypes{"string"}
+	case reflect.Bool:
+		n.Type = schemaTypes{"boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n.Type = schemaTypes{"integer"}
+	case reflect.Float32, reflect.Float64:
+		n.Type = schemaTypes{"number"}
+	case reflect.Interface:
+	default:
+		return nil, fmt.Errorf("unsupported type %v", rt)
+	}
+	return n, nil
+}
+
+func (n *schemaNode) applyOptions(rt reflect.Type, opts *fieldOptions) error {
+	for _, o := range opts.options {
+		n.Enum = append(n.Enum, o)
+	}
+	if r := opts.bounds; r != nil {
+		if len(n.Type) > 0 && !n.Type.match(float64(0), false) {
+			return fmt.Errorf("range is not supported on %v", rt)
+		}
+		if r.leftSet {
+			left := r.left
+			if r.leftInclude {
+				n.Minimum = &left
+			} else {
+				n.ExclusiveMinimum = &left
+			}
+		}
+		if r.rightSet {
+			right := r.right
+			if r.rightInclude {
+				n.Maximum = &right
+			} else {
+				n.ExclusiveMaximum = &right
+			}
+		}
+	}
+	return nil
+}
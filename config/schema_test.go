@@ -0,0 +1,138 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["name", "redis"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+		"port": {"type": "integer", "minimum": 1, "exclusiveMaximum": 65536},
+		"mode": {"enum": ["dev", "prod"]},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+		"redis": {
+			"type": "object",
+			"required": ["addr"],
+			"properties": {"addr": {"type": "string"}, "db": {"type": ["integer", "null"]}}
+		}
+	}
+}`
+
+func TestSchema_Validate(t *testing.T) {
+	s, err := NewSchema([]byte(testSchema))
+	assert.Nil(t, err)
+
+	tests := []struct {
+		name   string
+		values map[string]any
+		errs   []string
+	}{
+		{
+			name:   "valid",
+			values: map[string]any{"name": "app", "port": float64(8080), "mode": "dev", "tags": []any{"a"}, "redis": map[string]any{"addr": "127.0.0.1:6379", "db": nil}},
+		},
+		{
+			name:   "required",
+			values: map[string]any{},
+			errs:   []string{"name: field is required", "redis: field is required"},
+		},
+		{
+			name:   "types",
+			values: map[string]any{"name": "app", "port": 1.5, "tags": "a", "redis": map[string]any{"addr": 1, "db": "0"}},
+			errs:   []string{"port: expect integer, got number", "redis.addr: expect string, got number", "redis.db: expect integer or null, got string", "tags: expect array, got string"},
+		},
+		{
+			name:   "constraints",
+			values: map[string]any{"name": "App", "port": float64(65536), "mode": "test", "tags": []any{"a", "b", 1}, "redis": map[string]any{"addr": ""}, "debug": true},
+			errs:   []string{"mode: value is not one of [\"dev\",\"prod\"]", "name: value does not match \"^[a-z]+$\"", "port: value is not less than 65536", "tags: items are more than 2", "tags[2]: expect string, got number", "debug: is not allowed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate(tt.values)
+			if len(tt.errs) == 0 {
+				assert.Nil(t, err)
+				return
+			}
+			var ve *ValidationError
+			assert.True(t, errors.As(err, &ve))
+			var msgs []string
+			for _, e := range ve.Errors {
+				msgs = append(msgs, e.Error())
+			}
+			assert.Equal(t, tt.errs, msgs)
+		})
+	}
+
+	_, err = NewSchema([]byte(`{"pattern": "["}`))
+	assert.NotNil(t, err)
+}
+
+func TestSchemaOf(t *testing.T) {
+	s, err := SchemaOf(&testServerConf{})
+	assert.Nil(t, err)
+
+	err = s.Validate(map[string]any{"name": "app", "rate": "0.5", "Redis": map[string]any{"addr": "127.0.0.1:6379", "type": "cluster", "db": float64(15)}})
+	assert.Nil(t, err)
+
+	err = s.Validate(map[string]any{"rate": float64(2), "redis": map[string]any{"type": "sentinel", "db": float64(16)}})
+	assert.Equal(t, "name: field is required; rate: value is greater than 1; redis.addr: field is required; redis.db: value is not less than 16; redis.type: value is not one of [\"node\",\"cluster\"]", err.Error())
+
+	_, err = SchemaOf(map[string]any{})
+	assert.NotNil(t, err)
+
+	type node struct {
+		Name     string
+		Children []node `json:",optional"`
+		Parent   *node  `json:",optional"`
+	}
+	s, err = SchemaOf(&node{})
+	assert.Nil(t, err)
+	assert.Nil(t, s.Validate(map[string]any{"name": "a", "children": []any{map[string]any{"name": "b"}}}))
+	assert.NotNil(t, s.Validate(map[string]any{"children": []any{}}))
+}
+
+func TestNewSchema_UnknownKeywords(t *testing.T) {
+	_, err := NewSchema([]byte(`{"$schema": "http://json-schema.org/draft-07/schema#", "title": "app", "type": "object"}`))
+	assert.Nil(t, err)
+	_, err = NewSchema([]byte(`{"type": "object", "properties": {"port": {"oneOf": [{"type": "integer"}]}}}`))
+	assert.EqualError(t, err, "invalid schema: unsupported keywords oneOf")
+	_, err = NewSchema([]byte(`{"$ref": "#/definitions/a", "definitions": {"a": {}}}`))
+	assert.EqualError(t, err, "invalid schema: unsupported keywords $ref, definitions")
+}
+
+func TestConfig_Schema(t *testing.T) {
+	s, err := SchemaOf(&testRedisConf{})
+	assert.Nil(t, err)
+
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"addr":"127.0.0.1:6379","db":1}`)})
+	c := New(WithSource(src), WithSchema(s))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	var changes int
+	c.WatchPrefix("", func(prefix string, cs *ChangeSet) {
+		changes++
+	})
+	// the invalid update is rejected
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"addr":"127.0.0.1:6379","db":100}`)})
+	assert.Equal(t, int64(1), c.Value("db").IntOrDefault(0))
+	assert.Equal(t, 0, changes)
+
+	// and the next update is merged on the valid one
+	src.push(&KeyValue{Key: "other.json", Format: "json", Value: []byte(`{"type":"cluster"}`)})
+	assert.Equal(t, int64(1), c.Value("db").IntOrDefault(0))
+	assert.Equal(t, "cluster", c.Value("type").StringOrDefault(""))
+	assert.Equal(t, 1, changes)
+
+	invalid := New(WithSource(newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"db":1}`)})), WithSchema(s))
+	var ve *ValidationError
+	assert.True(t, errors.As(invalid.Load(), &ve))
+}
@@ -0,0 +1,192 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mcdull-kk/pkg/codec"
+)
+
+// redacted replaces secret values when config is dumped, same as log.Filter.
+const redacted = "***"
+
+var encRegexp = regexp.MustCompile(`^ENC\((.+)\)$`)
+
+type (
+	// Decrypter decrypts the base64 cipher text in ENC(...) values.
+	Decrypter interface {
+		Decrypt(cipher string) (string, error)
+	}
+
+	// SecretProvider loads the secret referenced by ${secret:scheme:ref}.
+	SecretProvider interface {
+		Secret(ref string) (string, error)
+	}
+
+	rsaDecrypter struct {
+		codec.RsaDecrypter
+	}
+
+	aesDecrypter struct {
+		key string
+	}
+
+	fileSecretProvider struct{}
+)
+
+// NewRsaDecrypter returns a Decrypter with the RSA private key file.
+func NewRsaDecrypter(file string) (Decrypter, error) {
+	d, err := codec.NewRsaDecrypter(file)
+	if err != nil {
+		return nil, err
+	}
+	return &rsaDecrypter{RsaDecrypter: d}, nil
+}
+
+// NewAesDecrypter returns a Decrypter with the AES-ECB key, key longer
+// than 32 bytes is treated as base64 encoded.
+func NewAesDecrypter(key string) Decrypter {
+	return &aesDecrypter{key: key}
+}
+
+// NewFileSecretProvider returns a SecretProvider which reads the
+// secret file like /run/secrets/x, it is registered as "file" by default.
+func NewFileSecretProvider() SecretProvider {
+	return fileSecretProvider{}
+}
+
+func (d *rsaDecrypter) Decrypt(cipher string) (string, error) {
+	plain, err := d.DecryptBase64(cipher)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+func (d *aesDecrypter) Decrypt(cipher string) (string, error) {
+	plain, err := codec.EcbDecryptBase64(d.key, cipher)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(plain)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (fileSecretProvider) Secret(ref string) (string, error) {
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// resolveSecrets replaces ENC(...), ${secret:scheme:ref} and
+// ${file:path:default} in values with the plaintext and returns the
+// paths which hold secrets, $${...} is unescaped as is.
+func resolveSecrets(values map[string]any, opts *options) (map[string]struct{}, error) {
+	secrets := make(map[string]struct{})
+	resolve := func(path, s string) (string, error) {
+		if m := encRegexp.FindStringSubmatch(s); m != nil {
+			if opts.decrypter == nil {
+				return "", fmt.Errorf("%s: no decrypter for ENC value", path)
+			}
+			plain, err := opts.decrypter.Decrypt(m[1])
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", path, err)
+			}
+			secrets[path] = struct{}{}
+			return plain, nil
+		}
+		var err error
+		s = expandFunc(s, deferred, func(name string) string {
+			if !deferred(name) {
+				return "${" + name + "}"
+			}
+			plain, e := secret(strings.TrimSpace(name), opts)
+			if e != nil {
+				if err == nil {
+					err = fmt.Errorf("%s: %w", path, e)
+				}
+				return "${" + name + "}"
+			}
+			secrets[path] = struct{}{}
+			return plain
+		})
+		return s, err
+	}
+
+	var walk func(path string, v any) (any, error)
+	walk = func(path string, v any) (any, error) {
+		switch vt := v.(type) {
+		case string:
+			return resolve(path, vt)
+		case map[string]any:
+			for k, sub := range vt {
+				next, err := walk(joinPath(path, k), sub)
+				if err != nil {
+					return nil, err
+				}
+				vt[k] = next
+			}
+		case []any:
+			// arrays are redacted as a whole
+			for i, sub := range vt {
+				next, err := walk(path, sub)
+				if err != nil {
+					return nil, err
+				}
+				vt[i] = next
+			}
+		}
+		return v, nil
+	}
+	if _, err := walk("", values); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// secret returns the plaintext of the placeholder name
+// like secret:scheme:ref or file:path:default.
+func secret(name string, opts *options) (string, error) {
+	scheme, ref, _ := strings.Cut(name, ":")
+	if scheme == "file" {
+		file, def, hasDef := strings.Cut(ref, ":")
+		plain, err := fileSecretProvider{}.Secret(file)
+		if err != nil && hasDef {
+			return def, nil
+		}
+		return plain, err
+	}
+	scheme, ref, _ = strings.Cut(ref, ":")
+	p, ok := opts.secrets[scheme]
+	if !ok {
+		return "", fmt.Errorf("unknown secret provider %q", scheme)
+	}
+	return p.Secret(ref)
+}
+
+// redact returns a copy of values with the secret paths masked.
+func redact(values map[string]any, secrets map[string]struct{}) map[string]any {
+	var mask func(path string, v any) any
+	mask = func(path string, v any) any {
+		if _, ok := secrets[path]; ok && path != "" {
+			return redacted
+		}
+		if m, ok := v.(map[string]any); ok {
+			masked := make(map[string]any, len(m))
+			for k, sub := range m {
+				masked[k] = mask(joinPath(path, k), sub)
+			}
+			return masked
+		}
+		return v
+	}
+	return mask("", values).(map[string]any)
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mcdull-kk/pkg/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecrypter(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+	file := filepath.Join(t.TempDir(), "private.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	assert.Nil(t, os.WriteFile(file, data, 0o600))
+
+	cipher, err := rsa.EncryptPKCS1v15(rand.Reader, &key.PublicKey, []byte("foobar"))
+	assert.Nil(t, err)
+	d, err := NewRsaDecrypter(file)
+	assert.Nil(t, err)
+	plain, err := d.Decrypt(base64.StdEncoding.EncodeToString(cipher))
+	assert.Nil(t, err)
+	assert.Equal(t, "foobar", plain)
+
+	aesKey := "q4t7w!z%C*F-JaNu"
+	enc, err := codec.EcbEncryptBase64(aesKey, base64.StdEncoding.EncodeToString([]byte("foobar")))
+	assert.Nil(t, err)
+	plain, err = NewAesDecrypter(aesKey).Decrypt(enc)
+	assert.Nil(t, err)
+	assert.Equal(t, "foobar", plain)
+}
+
+func TestConfig_Secret(t *testing.T) {
+	aesKey := "q4t7w!z%C*F-JaNu"
+	enc, err := codec.EcbEncryptBase64(aesKey, base64.StdEncoding.EncodeToString([]byte("redis-pass")))
+	assert.Nil(t, err)
+	file := filepath.Join(t.TempDir(), "token")
+	assert.Nil(t, os.WriteFile(file, []byte("s3cret\n"), 0o600))
+
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{
+		"redis": {"addr": "127.0.0.1:6379", "pass": "ENC(` + enc + `)"},
+		"token": "Bearer ${secret:file:` + file + `}",
+		"auth": "${token}"
+	}`)})
+	c := New(WithSource(src), WithDecrypter(NewAesDecrypter(aesKey)))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	assert.Equal(t, "redis-pass", c.Value("redis.pass").StringOrDefault(""))
+	assert.Equal(t, "Bearer s3cret", c.Value("token").StringOrDefault(""))
+	assert.Equal(t, "Bearer s3cret", c.Value("auth").StringOrDefault(""))
+
+	dump, err := c.Dump()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"redis":{"addr":"127.0.0.1:6379","pass":"***"},"token":"***","auth":"***"}`, string(dump))
+
+	c = New(WithSource(src))
+	assert.NotNil(t, c.Load())
+	c = New(WithSource(newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"token":"${secret:vault:x}"}`)})))
+	assert.NotNil(t, c.Load())
+}
+
+func TestConfig_FileSecret(t *testing.T) {
+	file := writeSecret(t, "s3cret")
+	snapshot := filepath.Join(t.TempDir(), "snapshot.json")
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{
+		"token": "${file:` + file + `}",
+		"auth": "Bearer ${token}",
+		"raw": "$${secret:file:` + file + `}",
+		"def": "${file:/notexist/token:none}"
+	}`)})
+	c := New(WithSource(src), WithSnapshotFile(snapshot))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	assert.Equal(t, "s3cret", c.Value("token").StringOrDefault(""))
+	assert.Equal(t, "Bearer s3cret", c.Value("auth").StringOrDefault(""))
+	assert.Equal(t, "${secret:file:"+file+"}", c.Value("raw").StringOrDefault(""))
+	assert.Equal(t, "none", c.Value("def").StringOrDefault(""))
+	assert.Equal(t, redacted, c.Snapshot().Values["token"])
+	assert.Equal(t, redacted, c.Snapshot().Values["auth"])
+
+	data, err := os.ReadFile(snapshot)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+
+	c = New(WithSource(newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"token":"${file:/notexist/token}"}`)})))
+	assert.NotNil(t, c.Load())
+}
+
+func TestConfig_SecretKeyValue(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "snapshot.json")
+	src := newTestSource(
+		&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull","db":{"user":"root"}}`)},
+		&KeyValue{Key: "db.json", Format: "json", Value: []byte(`{"db":{"password":"s3cret"}}`), Secret: true},
+	)
+	c := New(WithSource(src), WithSnapshotFile(snapshot))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+
+	assert.Equal(t, "s3cret", c.Value("db.password").StringOrDefault(""))
+	dump, err := c.Dump()
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"name":"mcdull","db":{"user":"root","password":"***"}}`, string(dump))
+	data, err := os.ReadFile(snapshot)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.Contains(t, string(data), "mcdull")
+}
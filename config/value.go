@@ -0,0 +1,221 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/mcdull-kk/pkg/codec"
+)
+
+var (
+	_ Value = (*atomicValue)(nil)
+	_ Value = errValue{}
+)
+
+type (
+	// Value is config value interface.
+	Value interface {
+		Bool() (bool, error)
+		Int() (int64, error)
+		Float() (float64, error)
+		String() (string, error)
+		Duration() (time.Duration, error)
+		Slice() ([]Value, error)
+		Map() (map[string]Value, error)
+		Scan(v any) error
+		BoolOrDefault(def bool) bool
+		IntOrDefault(def int64) int64
+		FloatOrDefault(def float64) float64
+		StringOrDefault(def string) string
+		DurationOrDefault(def time.Duration) time.Duration
+		Load() any
+		Store(v any)
+	}
+
+	atomicValue struct {
+		v atomic.Value
+	}
+
+	// holder wraps the value, since atomic.Value can not store nil.
+	holder struct {
+		v any
+	}
+
+	errValue struct {
+		err error
+	}
+)
+
+func newValue(v any) Value {
+	av := &atomicValue{}
+	av.Store(v)
+	return av
+}
+
+// Load returns the value, it is nil for a null leaf.
+func (v *atomicValue) Load() any {
+	if h, ok := v.v.Load().(holder); ok {
+		return h.v
+	}
+	return nil
+}
+
+func (v *atomicValue) Store(val any) {
+	v.v.Store(holder{v: val})
+}
+
+func (v *atomicValue) typeAssertError() error {
+	return fmt.Errorf("type assert to %v failed", reflect.TypeOf(v.Load()))
+}
+
+func (v *atomicValue) Bool() (bool, error) {
+	switch val := v.Load().(type) {
+	case bool:
+		return val, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return codec.Bool(val), nil
+	case string:
+		return strconv.ParseBool(val)
+	}
+	return false, v.typeAssertError()
+}
+
+func (v *atomicValue) Int() (int64, error) {
+	switch val := v.Load().(type) {
+	case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64:
+		return codec.Int(val), nil
+	case uint:
+		return int64(val), nil
+	case string:
+		return strconv.ParseInt(val, 10, 64) //nolint:gomnd
+	}
+	return 0, v.typeAssertError()
+}
+
+func (v *atomicValue) Float() (float64, error) {
+	switch val := v.Load().(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float64:
+		return codec.Float(val), nil
+	case float32:
+		return float64(val), nil
+	case string:
+		return strconv.ParseFloat(val, 64) //nolint:gomnd
+	}
+	return 0.0, v.typeAssertError()
+}
+
+func (v *atomicValue) String() (string, error) {
+	switch val := v.Load().(type) {
+	case string:
+		return val, nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, []byte:
+		return codec.Repr(val), nil
+	case fmt.Stringer:
+		return val.String(), nil
+	}
+	return "", v.typeAssertError()
+}
+
+// Duration parses string value with time.ParseDuration,
+// numeric value is treated as nanoseconds.
+func (v *atomicValue) Duration() (time.Duration, error) {
+	switch val := v.Load().(type) {
+	case time.Duration:
+		return val, nil
+	case string:
+		return time.ParseDuration(val)
+	}
+	i, err := v.Int()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(i), nil
+}
+
+func (v *atomicValue) Slice() ([]Value, error) {
+	vals, ok := v.Load().([]any)
+	if !ok {
+		return nil, v.typeAssertError()
+	}
+	slices := make([]Value, 0, len(vals))
+	for _, val := range vals {
+		slices = append(slices, newValue(val))
+	}
+	return slices, nil
+}
+
+func (v *atomicValue) Map() (map[string]Value, error) {
+	vals, ok := v.Load().(map[string]any)
+	if !ok {
+		return nil, v.typeAssertError()
+	}
+	m := make(map[string]Value, len(vals))
+	for key, val := range vals {
+		m[key] = newValue(val)
+	}
+	return m, nil
+}
+
+// Scan unmarshal the value into v through json codec.
+func (v *atomicValue) Scan(obj any) error {
+	data, err := codec.GetCodec(codec.JsonName).Marshal(v.Load())
+	if err != nil {
+		return err
+	}
+	return codec.GetCodec(codec.JsonName).Unmarshal(data, obj)
+}
+
+func (v *atomicValue) BoolOrDefault(def bool) bool {
+	if b, err := v.Bool(); err == nil {
+		return b
+	}
+	return def
+}
+
+func (v *atomicValue) IntOrDefault(def int64) int64 {
+	if i, err := v.Int(); err == nil {
+		return i
+	}
+	return def
+}
+
+func (v *atomicValue) FloatOrDefault(def float64) float64 {
+	if f, err := v.Float(); err == nil {
+		return f
+	}
+	return def
+}
+
+func (v *atomicValue) StringOrDefault(def string) string {
+	if s, err := v.String(); err == nil {
+		return s
+	}
+	return def
+}
+
+func (v *atomicValue) DurationOrDefault(def time.Duration) time.Duration {
+	if d, err := v.Duration(); err == nil {
+		return d
+	}
+	return def
+}
+
+// errValue is returned for missing keys, every accessor reports err.
+func (v errValue) Bool() (bool, error)                               { return false, v.err }
+func (v errValue) Int() (int64, error)                               { return 0, v.err }
+func (v errValue) Float() (float64, error)                           { return 0.0, v.err }
+func (v errValue) String() (string, error)                           { return "", v.err }
+func (v errValue) Duration() (time.Duration, error)                  { return 0, v.err }
+func (v errValue) Slice() ([]Value, error)                           { return nil, v.err }
+func (v errValue) Map() (map[string]Value, error)                    { return nil, v.err }
+func (v errValue) Scan(any) error                                    { return v.err }
+func (v errValue) BoolOrDefault(def bool) bool                       { return def }
+func (v errValue) IntOrDefault(def int64) int64                      { return def }
+func (v errValue) FloatOrDefault(def float64) float64                { return def }
+func (v errValue) StringOrDefault(def string) string                 { return def }
+func (v errValue) DurationOrDefault(def time.Duration) time.Duration { return def }
+func (v errValue) Load() any                                         { return nil }
+func (v errValue) Store(any)                                         {}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAtomicValue(t *testing.T) {
+	vlist := []any{"1", 1, int64(1), float64(1), uint(1)}
+	for _, x := range vlist {
+		v := newValue(x)
+		i, err := v.Int()
+		assert.Nil(t, err)
+		assert.Equal(t, int64(1), i)
+		f, err := v.Float()
+		assert.Nil(t, err)
+		assert.Equal(t, float64(1), f)
+		s, err := v.String()
+		assert.Nil(t, err)
+		assert.Equal(t, "1", s)
+		b, err := v.Bool()
+		assert.Nil(t, err)
+		assert.True(t, b)
+	}
+
+	v := newValue("1s")
+	d, err := v.Duration()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, d)
+	d, err = newValue(int64(time.Second)).Duration()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, d)
+
+	_, err = newValue("abc").Int()
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(10), newValue("abc").IntOrDefault(10))
+	_, err = newValue(map[string]any{}).String()
+	assert.NotNil(t, err)
+}
+
+func TestAtomicValue_Collection(t *testing.T) {
+	v := newValue([]any{"a", 2})
+	vs, err := v.Slice()
+	assert.Nil(t, err)
+	assert.Len(t, vs, 2)
+	assert.Equal(t, "a", vs[0].StringOrDefault(""))
+	assert.Equal(t, int64(2), vs[1].IntOrDefault(0))
+
+	v = newValue(map[string]any{"addr": "127.0.0.1:6379", "db": 1})
+	m, err := v.Map()
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:6379", m["addr"].StringOrDefault(""))
+
+	var conf struct {
+		Addr string `json:"addr"`
+		DB   int    `json:"db"`
+	}
+	assert.Nil(t, v.Scan(&conf))
+	assert.Equal(t, 1, conf.DB)
+
+	_, err = v.Slice()
+	assert.NotNil(t, err)
+}
+
+func TestConfig_ValueNotFound(t *testing.T) {
+	c := New()
+	v := c.Value("not.exist")
+	_, err := v.Int()
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, "foo", v.StringOrDefault("foo"))
+	assert.Equal(t, time.Second, v.DurationOrDefault(time.Second))
+	assert.Nil(t, v.Load())
+	_, err = c.Watch("not.exist", func(string, Value) {})
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestConfig_NullValue(t *testing.T) {
+	src := newTestSource(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull","foo":null}`)})
+	c := New(WithSource(src))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	v := c.Value("foo")
+	assert.Nil(t, v.Load())
+	_, err := v.String()
+	assert.NotNil(t, err)
+	assert.Equal(t, "def", v.StringOrDefault("def"))
+
+	var calls []any
+	_, err = c.Watch("name", func(key string, v Value) {
+		calls = append(calls, v.Load())
+	})
+	assert.Nil(t, err)
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":null}`)})
+	assert.Nil(t, c.Value("name").Load())
+	// the watch loop keeps applying updates after the null one
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"kk"}`)})
+	assert.Equal(t, "kk", c.Value("name").StringOrDefault(""))
+	assert.Equal(t, []any{nil, "kk"}, calls)
+
+	// the key of null value can be watched, the missing one can not
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"kk","foo":null}`)})
+	var foo []any
+	_, err = c.Watch("foo", func(key string, v Value) {
+		foo = append(foo, v.Load())
+	})
+	assert.Nil(t, err)
+	_, err = c.Watch("bar", func(key string, v Value) {})
+	assert.Equal(t, ErrNotFound, err)
+	src.push(&KeyValue{Key: "app.json", Format: "json", Value: []byte(`{"name":"kk","foo":"bar"}`)})
+	assert.Equal(t, []any{"bar"}, foo)
+}
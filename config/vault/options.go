@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultMount    = "secret"
+	defaultInterval = 30 * time.Second
+)
+
+type (
+	Option func(*options)
+
+	options struct {
+		ctx       context.Context
+		client    *http.Client
+		addr      string
+		namespace string
+		mount     string
+		paths     []string
+		interval  time.Duration
+		token     string
+		roleID    string
+		secretID  string
+	}
+)
+
+// WithAddr sets the address of Vault, such as http://127.0.0.1:8200.
+func WithAddr(addr string) Option {
+	return func(o *options) {
+		o.addr = addr
+	}
+}
+
+// WithNamespace sets the Vault Enterprise namespace.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithMount sets the mount path of the KV v2 engine. Default is secret.
+func WithMount(mount string) Option {
+	return func(o *options) {
+		o.mount = mount
+	}
+}
+
+// WithPath adds the secret paths to load, each secret is a json KeyValue.
+func WithPath(paths ...string) Option {
+	return func(o *options) {
+		o.paths = append(o.paths, paths...)
+	}
+}
+
+// WithInterval sets the interval of polling the secret versions. Default is 30s.
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) {
+		o.interval = interval
+	}
+}
+
+// WithToken authenticates by the token.
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithAppRole authenticates by AppRole, the token is renewed,
+// and logged in again once it can not be renewed.
+func WithAppRole(roleID, secretID string) Option {
+	return func(o *options) {
+		o.roleID = roleID
+		o.secretID = secretID
+	}
+}
+
+func WithHttpClient(client *http.Client) Option {
+	return func(o *options) {
+		o.client = client
+	}
+}
+
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
@@ -0,0 +1,356 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mcdull-kk/pkg/codec"
+	"github.com/mcdull-kk/pkg/config"
+	"github.com/mcdull-kk/pkg/log"
+)
+
+var (
+	// ErrAddrEmpty is returned by NewSource without an address.
+	ErrAddrEmpty = errors.New("vault address is empty")
+	// ErrPathEmpty is returned by NewSource without any secret path.
+	ErrPathEmpty = errors.New("vault path is empty")
+	// ErrNoAuth is returned by NewSource without a token or AppRole.
+	ErrNoAuth = errors.New("vault token or approle is required")
+	// ErrPermissionDenied is returned if the token is not allowed to read a secret.
+	ErrPermissionDenied = errors.New("vault permission denied")
+)
+
+type (
+	vault struct {
+		opts *options
+
+		mu     sync.Mutex
+		token  string
+		authed bool
+		// renewAt is the time to renew the token, zero if it never expires
+		renewAt   time.Time
+		renewable bool
+		// versions are the loaded secret versions by path
+		versions map[string]int
+	}
+
+	// response is the response body of the Vault HTTP API.
+	response struct {
+		Data   json.RawMessage `json:"data"`
+		Auth   *auth           `json:"auth"`
+		Errors []string        `json:"errors"`
+	}
+
+	auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	}
+
+	// secret is the data of a KV v2 secret.
+	secret struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	}
+)
+
+// NewSource returns a source of the KV v2 secrets, each secret path
+// is a secret json KeyValue. The versions are watched by polling.
+func NewSource(opts ...Option) (config.Source, error) {
+	o := &options{
+		ctx:      context.Background(),
+		client:   http.DefaultClient,
+		mount:    defaultMount,
+		interval: defaultInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.addr == "" {
+		return nil, ErrAddrEmpty
+	}
+	if len(o.paths) == 0 {
+		return nil, ErrPathEmpty
+	}
+	if o.token == "" && o.roleID == "" {
+		return nil, ErrNoAuth
+	}
+	return &vault{opts: o, token: o.token}, nil
+}
+
+func (v *vault) Load() ([]*config.KeyValue, error) {
+	if err := v.renew(v.opts.ctx); err != nil {
+		return nil, err
+	}
+	kvs := make([]*config.KeyValue, 0, len(v.opts.paths))
+	versions := make(map[string]int, len(v.opts.paths))
+	for _, p := range v.opts.paths {
+		s, err := v.read(v.opts.ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			continue
+		}
+		versions[p] = s.Metadata.Version
+		kvs = append(kvs, keyValue(p, s))
+	}
+
+	v.mu.Lock()
+	v.versions = versions
+	v.mu.Unlock()
+	return kvs, nil
+}
+
+// changes returns the secrets of new versions. If a secret is created or
+// deleted, all the secrets are reported to keep the merge order of paths.
+func (v *vault) changes(ctx context.Context) ([]*config.KeyValue, error) {
+	var (
+		all      = make([]*config.KeyValue, 0, len(v.opts.paths))
+		changed  []*config.KeyValue
+		versions = make(map[string]int, len(v.opts.paths))
+	)
+	v.mu.Lock()
+	old := v.versions
+	v.mu.Unlock()
+	for _, p := range v.opts.paths {
+		s, err := v.read(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			continue
+		}
+		versions[p] = s.Metadata.Version
+		kv := keyValue(p, s)
+		all = append(all, kv)
+		if ver, ok := old[p]; !ok || ver != s.Metadata.Version {
+			changed = append(changed, kv)
+		}
+	}
+
+	v.mu.Lock()
+	v.versions = versions
+	v.mu.Unlock()
+	if len(versions) == len(old) && len(changed) == 0 {
+		return nil, nil
+	}
+	for p := range old {
+		if _, ok := versions[p]; !ok {
+			return v.rebuild(old, all), nil
+		}
+	}
+	for _, kv := range changed {
+		if _, ok := old[kv.Key]; !ok {
+			return v.rebuild(old, all), nil
+		}
+	}
+	return changed, nil
+}
+
+// rebuild reports the old secrets deleted before all the current ones.
+func (v *vault) rebuild(old map[string]int, all []*config.KeyValue) []*config.KeyValue {
+	kvs := make([]*config.KeyValue, 0, len(old)+len(all))
+	for _, p := range v.opts.paths {
+		if _, ok := old[p]; ok {
+			kvs = append(kvs, &config.KeyValue{Key: p, Deleted: true})
+		}
+	}
+	return append(kvs, all...)
+}
+
+// read reads the latest version of the secret at p, it returns nil if the
+// secret does not exist or is deleted. The AppRole logs in again once the
+// token is denied, such as it is expired or revoked.
+func (v *vault) read(ctx context.Context, p string) (*secret, error) {
+	var rsp response
+	code, err := v.do(ctx, http.MethodGet, path.Join(v.opts.mount, "data", p), nil, &rsp)
+	if errors.Is(err, ErrPermissionDenied) && v.opts.roleID != "" {
+		if err = v.login(ctx); err != nil {
+			return nil, err
+		}
+		rsp = response{}
+		code, err = v.do(ctx, http.MethodGet, path.Join(v.opts.mount, "data", p), nil, &rsp)
+	}
+	if code == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &secret{}
+	if err = json.Unmarshal(rsp.Data, s); err != nil {
+		return nil, err
+	}
+	if len(s.Data) == 0 || string(s.Data) == "null" {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// renew logs in or looks up the token at first, then renews
+// the token once 2/3 of its ttl passed.
+func (v *vault) renew(ctx context.Context) error {
+	v.mu.Lock()
+	authed, renewAt, renewable := v.authed, v.renewAt, v.renewable
+	v.mu.Unlock()
+	if !authed {
+		if v.opts.roleID != "" {
+			return v.login(ctx)
+		}
+		return v.lookup(ctx)
+	}
+	if renewAt.IsZero() || time.Now().Before(renewAt) {
+		return nil
+	}
+	if renewable {
+		var rsp response
+		_, err := v.do(ctx, http.MethodPost, "auth/token/renew-self", struct{}{}, &rsp)
+		if err == nil && rsp.Auth != nil {
+			v.setAuth(rsp.Auth)
+			return nil
+		}
+		log.Warnf("vault failed to renew token: %v", err)
+	}
+	if v.opts.roleID == "" {
+		log.Warnf("vault token can not be renewed, it expires soon")
+		v.mu.Lock()
+		v.renewAt = time.Time{}
+		v.mu.Unlock()
+		return nil
+	}
+	return v.login(ctx)
+}
+
+func (v *vault) login(ctx context.Context) error {
+	v.mu.Lock()
+	v.token = ""
+	v.mu.Unlock()
+	var rsp response
+	body := map[string]string{"role_id": v.opts.roleID, "secret_id": v.opts.secretID}
+	if _, err := v.do(ctx, http.MethodPost, "auth/approle/login", body, &rsp); err != nil {
+		return err
+	}
+	if rsp.Auth == nil || rsp.Auth.ClientToken == "" {
+		return errors.New("vault: no token in approle login response")
+	}
+	v.setAuth(rsp.Auth)
+	return nil
+}
+
+// lookup reads the ttl of the given token to renew it in time.
+func (v *vault) lookup(ctx context.Context) error {
+	var rsp response
+	if _, err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil, &rsp); err != nil {
+		return err
+	}
+	var data struct {
+		TTL       int  `json:"ttl"`
+		Renewable bool `json:"renewable"`
+	}
+	if err := json.Unmarshal(rsp.Data, &data); err != nil {
+		return err
+	}
+	v.setAuth(&auth{ClientToken: v.opts.token, LeaseDuration: data.TTL, Renewable: data.Renewable})
+	return nil
+}
+
+func (v *vault) setAuth(a *auth) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.authed = true
+	if a.ClientToken != "" {
+		v.token = a.ClientToken
+	}
+	v.renewable = a.Renewable
+	v.renewAt = time.Time{}
+	if a.LeaseDuration > 0 {
+		ttl := time.Duration(a.LeaseDuration) * time.Second
+		v.renewAt = time.Now().Add(ttl * 2 / 3)
+	}
+}
+
+// wait returns the duration to the next poll or renewal.
+func (v *vault) wait() time.Duration {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	wait := v.opts.interval
+	if !v.renewAt.IsZero() {
+		if until := time.Until(v.renewAt); until < wait {
+			wait = until
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// do calls the Vault HTTP API of p, and decodes the response into rsp.
+func (v *vault) do(ctx context.Context, method, p string, body any, rsp *response) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(v.opts.addr, "/")+"/v1/"+p, reader)
+	if err != nil {
+		return 0, err
+	}
+	v.mu.Lock()
+	token := v.token
+	v.mu.Unlock()
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.opts.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.namespace)
+	}
+	resp, err := v.opts.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(rsp)
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return resp.StatusCode, fmt.Errorf("%w: %s %s", ErrPermissionDenied, method, p)
+	case resp.StatusCode >= http.StatusMultipleChoices:
+		return resp.StatusCode, fmt.Errorf("vault: %s %s: %d %s", method, p, resp.StatusCode, strings.Join(rsp.Errors, "; "))
+	case err != nil && err != io.EOF:
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+func (v *vault) Watch() (config.Watcher, error) {
+	return newWatcher(v), nil
+}
+
+func (v *vault) Close() error {
+	return nil
+}
+
+func keyValue(p string, s *secret) *config.KeyValue {
+	return &config.KeyValue{
+		Key:    p,
+		Value:  s.Data,
+		Format: codec.JsonName,
+		Secret: true,
+	}
+}
@@ -0,0 +1,190 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mcdull-kk/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVault is a stand-in of the Vault KV v2 and auth APIs.
+type fakeVault struct {
+	mu       sync.Mutex
+	secrets  map[string][]map[string]any
+	tokens   map[string]bool
+	ttl      int
+	logins   int
+	renewals int
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, string) {
+	f := &fakeVault{
+		secrets: make(map[string][]map[string]any),
+		tokens:  map[string]bool{"root": true},
+	}
+	s := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(s.Close)
+	return f, s.URL
+}
+
+// put writes a new version of the secret, nil deletes it.
+func (f *fakeVault) put(p string, data map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.secrets[p] = append(f.secrets[p], data)
+}
+
+func (f *fakeVault) revoke() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens = make(map[string]bool)
+}
+
+func (f *fakeVault) count() (logins, renewals int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.logins, f.renewals
+}
+
+func (f *fakeVault) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(code int, v any) {
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			reply(http.StatusBadRequest, map[string]any{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+		f.logins++
+		token := "token-" + string(rune('0'+f.logins))
+		f.tokens[token] = true
+		reply(http.StatusOK, map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": f.ttl, "renewable": true}})
+		return
+	}
+	if !f.tokens[r.Header.Get("X-Vault-Token")] {
+		reply(http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	switch {
+	case r.URL.Path == "/v1/auth/token/lookup-self":
+		reply(http.StatusOK, map[string]any{"data": map[string]any{"ttl": f.ttl, "renewable": true}})
+	case r.URL.Path == "/v1/auth/token/renew-self":
+		f.renewals++
+		reply(http.StatusOK, map[string]any{"auth": map[string]any{"client_token": r.Header.Get("X-Vault-Token"), "lease_duration": f.ttl, "renewable": true}})
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		versions := f.secrets[strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")]
+		if len(versions) == 0 {
+			reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+		data := versions[len(versions)-1]
+		if data == nil {
+			// the latest version is deleted
+			reply(http.StatusNotFound, map[string]any{"data": map[string]any{"data": nil, "metadata": map[string]any{"version": len(versions)}}})
+			return
+		}
+		reply(http.StatusOK, map[string]any{"data": map[string]any{"data": data, "metadata": map[string]any{"version": len(versions)}}})
+	default:
+		reply(http.StatusNotFound, map[string]any{"errors": []string{}})
+	}
+}
+
+func Test_vault(t *testing.T) {
+	f, addr := newFakeVault(t)
+	f.put("app/db", map[string]any{"password": "v1"})
+	f.put("app/redis", map[string]any{"password": "redis"})
+
+	s, err := NewSource(WithAddr(addr), WithToken("root"), WithPath("app/db", "app/cache"), WithInterval(10*time.Millisecond))
+	assert.Nil(t, err)
+	kvs, err := s.Load()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{{Key: "app/db", Value: []byte(`{"password":"v1"}`), Format: "json", Secret: true}}, kvs)
+
+	w, err := s.Watch()
+	assert.Nil(t, err)
+	defer w.Stop()
+	f.put("app/db", map[string]any{"password": "v2"})
+	kvs, err = w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{{Key: "app/db", Value: []byte(`{"password":"v2"}`), Format: "json", Secret: true}}, kvs)
+
+	// a created secret is merged in the order of paths
+	f.put("app/cache", map[string]any{"ttl": 1})
+	kvs, err = w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{
+		{Key: "app/db", Deleted: true},
+		{Key: "app/db", Value: []byte(`{"password":"v2"}`), Format: "json", Secret: true},
+		{Key: "app/cache", Value: []byte(`{"ttl":1}`), Format: "json", Secret: true},
+	}, kvs)
+
+	f.put("app/db", nil)
+	kvs, err = w.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []*config.KeyValue{
+		{Key: "app/db", Deleted: true},
+		{Key: "app/cache", Deleted: true},
+		{Key: "app/cache", Value: []byte(`{"ttl":1}`), Format: "json", Secret: true},
+	}, kvs)
+}
+
+func Test_appRole(t *testing.T) {
+	f, addr := newFakeVault(t)
+	f.ttl = 1
+	f.put("app/db", map[string]any{"password": "v1"})
+
+	s, err := NewSource(WithAddr(addr), WithAppRole("role", "secret"), WithPath("app/db"), WithInterval(time.Hour))
+	assert.Nil(t, err)
+	c := config.New(config.WithSource(s))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.Equal(t, "v1", c.Value("password").StringOrDefault(""))
+	assert.Equal(t, "***", c.Snapshot().Values["password"])
+
+	// the token of 1s ttl is renewed before it expires
+	assert.Eventually(t, func() bool {
+		_, renewals := f.count()
+		return renewals > 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// the revoked token is replaced by logging in again
+	f.revoke()
+	f.put("app/db", map[string]any{"password": "v2"})
+	assert.Eventually(t, func() bool {
+		return c.Value("password").StringOrDefault("") == "v2"
+	}, 2*time.Second, 10*time.Millisecond)
+	logins, _ := f.count()
+	assert.Equal(t, 2, logins)
+}
+
+func Test_newSource(t *testing.T) {
+	_, err := NewSource(WithToken("root"), WithPath("app"))
+	assert.Equal(t, ErrAddrEmpty, err)
+	_, err = NewSource(WithAddr("http://127.0.0.1:8200"), WithToken("root"))
+	assert.Equal(t, ErrPathEmpty, err)
+	_, err = NewSource(WithAddr("http://127.0.0.1:8200"), WithPath("app"))
+	assert.Equal(t, ErrNoAuth, err)
+
+	_, addr := newFakeVault(t)
+	s, err := NewSource(WithAddr(addr), WithToken("bad"), WithPath("app"))
+	assert.Nil(t, err)
+	_, err = s.Load()
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	s, err = NewSource(WithAddr(addr), WithAppRole("role", "bad"), WithPath("app"))
+	assert.Nil(t, err)
+	_, err = s.Load()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,46 @@
+package vault
+
+import (
+	"context"
+	"time"
+
+	"github.com/mcdull-kk/pkg/config"
+)
+
+var _ config.Watcher = (*watcher)(nil)
+
+type watcher struct {
+	vault  *vault
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newWatcher(v *vault) *watcher {
+	ctx, cancel := context.WithCancel(v.opts.ctx)
+	return &watcher{vault: v, ctx: ctx, cancel: cancel}
+}
+
+// Next polls the secret versions, and renews the token in time.
+func (w *watcher) Next() ([]*config.KeyValue, error) {
+	for {
+		timer := time.NewTimer(w.vault.wait())
+		select {
+		case <-w.ctx.Done():
+			timer.Stop()
+			return nil, w.ctx.Err()
+		case <-timer.C:
+		}
+		if err := w.vault.renew(w.ctx); err != nil {
+			return nil, err
+		}
+		kvs, err := w.vault.changes(w.ctx)
+		if err != nil || len(kvs) > 0 {
+			return kvs, err
+		}
+	}
+}
+
+func (w *watcher) Stop() error {
+	w.cancel()
+	return nil
+}
@@ -0,0 +1,177 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mcdull-kk/pkg/log"
+	"github.com/mcdull-kk/pkg/rescue"
+)
+
+// watching holds the current watcher of a source,
+// which is re-created after it fails.
+type watching struct {
+	src    *source
+	lock   sync.Mutex
+	w      Watcher
+	closed bool
+}
+
+func (ws *watching) current() Watcher {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return ws.w
+}
+
+// set replaces the watcher, it fails if the config is closed.
+func (ws *watching) set(w Watcher) bool {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if ws.closed {
+		return false
+	}
+	ws.w = w
+	return true
+}
+
+// drop stops the failed watcher w if it is still the current one.
+func (ws *watching) drop(w Watcher) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if ws.w != w {
+		return
+	}
+	if err := w.Stop(); err != nil {
+		log.Errorf("failed to stop config watcher of %s: %v", ws.src.name, err)
+	}
+	ws.w = nil
+}
+
+func (ws *watching) stop() error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.closed = true
+	if ws.w == nil {
+		return nil
+	}
+	w := ws.w
+	ws.w = nil
+	return w.Stop()
+}
+
+// watch applies the updates of the source until the config is closed,
+// a failed watcher is re-created with backoff and the source is fully
+// reloaded, since the updates in between may be lost.
+func (c *config) watch(ws *watching) {
+	c.loops.Add(1)
+	rescue.GoSafe(func() {
+		defer c.loops.Done()
+		b := &backoff{min: c.opts.backoffMin, max: c.opts.backoffMax}
+		for {
+			w := ws.current()
+			if w == nil {
+				if !c.reconnect(ws, b) {
+					return
+				}
+				continue
+			}
+			kvs, err := w.Next()
+			if err != nil {
+				if c.closed() {
+					return
+				}
+				if !errors.Is(err, context.Canceled) {
+					log.Errorf("failed to watch next config of %s: %v", ws.src.name, err)
+				}
+				c.setHealth(ws.src.name, err)
+				ws.drop(w)
+				if !c.sleep(b.next()) {
+					return
+				}
+				continue
+			}
+			b.reset()
+			c.setHealth(ws.src.name, nil)
+			if err := c.apply(ws.src, kvs, false); err != nil {
+				log.Errorf("failed to apply next config: %v", err)
+			}
+		}
+	})
+}
+
+// reconnect re-creates the watcher and reloads the source, it
+// returns false if the config is closed.
+func (c *config) reconnect(ws *watching, b *backoff) bool {
+	metricSourceReconnects.Inc(ws.src.name)
+	w, err := ws.src.Watch()
+	if err == nil {
+		var kvs []*KeyValue
+		if kvs, err = ws.src.Load(); err == nil {
+			if err := c.apply(ws.src, kvs, true); err != nil {
+				log.Errorf("failed to apply reloaded config of %s: %v", ws.src.name, err)
+			}
+		} else {
+			_ = w.Stop()
+		}
+	}
+	if err != nil {
+		log.Errorf("failed to reconnect config source %s: %v", ws.src.name, err)
+		c.setHealth(ws.src.name, err)
+		return c.sleep(b.next())
+	}
+	if !ws.set(w) {
+		_ = w.Stop()
+		return false
+	}
+	log.Infof("config source %s reconnected", ws.src.name)
+	c.setHealth(ws.src.name, nil)
+	return true
+}
+
+func (c *config) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep waits for d, it returns false if the config is closed.
+func (c *config) sleep(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+var _ Watcher = (*staticWatcher)(nil)
+
+type staticWatcher struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewStaticWatcher returns a watcher which never reports changes,
+// it is for the sources fixed after start like env and flags.
+func NewStaticWatcher() Watcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &staticWatcher{ctx: ctx, cancel: cancel}
+}
+
+// Next will be blocked until the Stop method is called
+func (w *staticWatcher) Next() ([]*KeyValue, error) {
+	<-w.ctx.Done()
+	return nil, w.ctx.Err()
+}
+
+func (w *staticWatcher) Stop() error {
+	w.cancel()
+	return nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// flakySource fails the first watcher and reloads with the latest kvs.
+	flakySource struct {
+		lock    sync.Mutex
+		kvs     []*KeyValue
+		watches int
+		fail    chan struct{}
+		*testSource
+	}
+
+	flakyWatcher struct {
+		*testWatcher
+		fail chan struct{}
+	}
+)
+
+func (s *flakySource) Load() ([]*KeyValue, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.kvs, nil
+}
+
+func (s *flakySource) Watch() (Watcher, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.watches++
+	if s.watches == 2 {
+		return nil, errors.New("connection refused")
+	}
+	w, _ := s.testSource.Watch()
+	fw := &flakyWatcher{testWatcher: w.(*testWatcher)}
+	if s.watches == 1 {
+		fw.fail = s.fail
+	}
+	return fw, nil
+}
+
+func (w *flakyWatcher) Next() ([]*KeyValue, error) {
+	select {
+	case <-w.fail:
+		return nil, errors.New("watch channel closed")
+	case kvs := <-w.ch:
+		return kvs, nil
+	case <-w.done:
+		return nil, context.Canceled
+	}
+}
+
+func TestConfig_Reconnect(t *testing.T) {
+	src := &flakySource{
+		kvs:        []*KeyValue{{Key: "app.json", Format: "json", Value: []byte(`{"name":"mcdull","port":8080}`)}},
+		fail:       make(chan struct{}),
+		testSource: newTestSource(),
+	}
+	c := New(WithSourceOptions(src, WithSourceName("flaky")), WithWatchBackoff(time.Millisecond, 10*time.Millisecond))
+	assert.Nil(t, c.Load())
+	defer c.Close(context.Background())
+	assert.True(t, c.Sources()[0].Healthy)
+
+	// the update is lost while the watcher is broken
+	src.lock.Lock()
+	src.kvs = []*KeyValue{{Key: "app.json", Format: "json", Value: []byte(`{"name":"kk"}`)}}
+	src.lock.Unlock()
+	close(src.fail)
+
+	assert.Eventually(t, func() bool {
+		return c.Value("name").StringOrDefault("") == "kk"
+	}, time.Second, time.Millisecond)
+	// reloaded as a whole
+	_, err := c.Value("port").Int()
+	assert.Equal(t, ErrNotFound, err)
+	status := c.Sources()[0]
+	assert.True(t, status.Healthy)
+	assert.Equal(t, 0, status.Failures)
+	src.lock.Lock()
+	assert.Equal(t, 3, src.watches)
+	src.lock.Unlock()
+}
+
+func TestBackoff(t *testing.T) {
+	b := &backoff{min: 100 * time.Millisecond, max: time.Second}
+	for _, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		d := b.next()
+		assert.True(t, d >= want*time.Millisecond/2 && d <= want*time.Millisecond, d)
+	}
+	b.reset()
+	assert.True(t, b.next() <= 100*time.Millisecond)
+}
+
+type (
+	closeSource struct {
+		*testSource
+		err  error
+		next chan struct{}
+	}
+
+	// stuckWatcher ignores Stop and never returns from Next.
+	stuckWatcher struct {
+		next chan struct{}
+	}
+)
+
+func (s *closeSource) Close() error { return s.err }
+
+func (s *closeSource) Watch() (Watcher, error) {
+	if s.err == nil {
+		return &stuckWatcher{next: s.next}, nil
+	}
+	return s.testSource.Watch()
+}
+
+func (w *stuckWatcher) Next() ([]*KeyValue, error) {
+	close(w.next)
+	select {}
+}
+
+func (w *stuckWatcher) Stop() error { return errors.New("stop timeout") }
+
+func TestConfig_Close(t *testing.T) {
+	src := &closeSource{testSource: newTestSource(), err: errors.New("client closed")}
+	c := New(WithSourceOptions(src, WithSourceName("app")))
+	assert.Nil(t, c.Load())
+	err := c.Close(context.Background())
+	var ce *CloseError
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, "close source app: client closed", err.Error())
+	assert.True(t, errors.Is(err, src.err))
+	// the watch loop has exited
+	assert.True(t, c.(*config).closed())
+	assert.Equal(t, err, c.Close(context.Background()))
+
+	stuck := &closeSource{testSource: newTestSource(), next: make(chan struct{})}
+	c = New(WithSourceOptions(stuck, WithSourceName("stuck")))
+	assert.Nil(t, c.Load())
+	<-stuck.next
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = c.Close(ctx)
+	assert.Equal(t, "stop watcher of stuck: stop timeout; context deadline exceeded", err.Error())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	// the calls of Close wait on the same exit of the loops
+	n := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		assert.NotNil(t, c.Close(ctx))
+	}
+	assert.Equal(t, n, runtime.NumGoroutine())
+}